@@ -0,0 +1,68 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// CanaryWeightAt returns the weight of the canary policy at the time for a fork created at the creation
+// It also returns how long until the weight changes next, which is zero when it doesn't change anymore
+func (s ForkSpec) CanaryWeightAt(creation, now time.Time) (int32, time.Duration) {
+	if s.Canary == nil || (s.Deadline != nil && !now.Before(s.Deadline.Time)) {
+		return 0, 0
+	}
+
+	weight := s.Canary.Weight
+	var next time.Duration
+	for _, step := range s.Canary.Steps {
+		at := creation.Add(step.After.Duration)
+		if now.Before(at) {
+			next = at.Sub(now)
+			break
+		}
+		weight = step.Weight
+	}
+	if s.Deadline != nil && (next == 0 || s.Deadline.Sub(now) < next) {
+		next = s.Deadline.Sub(now)
+	}
+	return weight, next
+}
+
+// Validate returns errors of weights out of range and steps out of order
+func (p CanaryPolicy) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	validWeight := func(weight int32, path *field.Path) {
+		if weight < 0 || weight > 100 {
+			errs = append(errs, field.Invalid(path, weight, "must be between 0 and 100"))
+		}
+	}
+
+	validWeight(p.Weight, path.Child("weight"))
+	var prev time.Duration
+	for i, step := range p.Steps {
+		stepPath := path.Child("steps").Index(i)
+		validWeight(step.Weight, stepPath.Child("weight"))
+		if step.After.Duration <= prev {
+			errs = append(errs, field.Invalid(stepPath.Child("after"), step.After.Duration.String(), "must be positive and later than the previous step"))
+		}
+		prev = step.After.Duration
+	}
+	return errs
+}
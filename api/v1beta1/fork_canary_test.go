@@ -0,0 +1,74 @@
+package v1beta1_test
+
+import (
+	"testing"
+	"time"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestForkSpecCanaryWeightAt(t *testing.T) {
+	creation, _ := time.Parse(time.RFC3339, "2009-11-10T23:00:00Z")
+	deadline := metav1.NewTime(creation.Add(3 * time.Hour))
+	canary := &forkv1beta1.CanaryPolicy{Weight: 5, Steps: []forkv1beta1.CanaryStep{
+		{After: metav1.Duration{Duration: time.Hour}, Weight: 20},
+		{After: metav1.Duration{Duration: 2 * time.Hour}, Weight: 50},
+	}}
+
+	testcases := []struct {
+		name       string
+		spec       forkv1beta1.ForkSpec
+		elapsed    time.Duration
+		wantWeight int32
+		wantNext   time.Duration
+	}{
+		{
+			name:    "without canary",
+			spec:    forkv1beta1.ForkSpec{},
+			elapsed: time.Hour,
+		},
+		{
+			name:       "before the first step",
+			spec:       forkv1beta1.ForkSpec{Canary: canary},
+			elapsed:    10 * time.Minute,
+			wantWeight: 5,
+			wantNext:   50 * time.Minute,
+		},
+		{
+			name:       "at a step",
+			spec:       forkv1beta1.ForkSpec{Canary: canary},
+			elapsed:    time.Hour,
+			wantWeight: 20,
+			wantNext:   time.Hour,
+		},
+		{
+			name:       "after the last step",
+			spec:       forkv1beta1.ForkSpec{Canary: canary},
+			elapsed:    150 * time.Minute,
+			wantWeight: 50,
+		},
+		{
+			name:       "after the last step with deadline",
+			spec:       forkv1beta1.ForkSpec{Canary: canary, Deadline: &deadline},
+			elapsed:    150 * time.Minute,
+			wantWeight: 50,
+			wantNext:   30 * time.Minute,
+		},
+		{
+			name:    "at the deadline",
+			spec:    forkv1beta1.ForkSpec{Canary: canary, Deadline: &deadline},
+			elapsed: 3 * time.Hour,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			weight, next := tc.spec.CanaryWeightAt(creation, creation.Add(tc.elapsed))
+			if weight != tc.wantWeight || next != tc.wantNext {
+				t.Errorf("CanaryWeightAt() = (%d, %s), want (%d, %s)", weight, next, tc.wantWeight, tc.wantNext)
+			}
+		})
+	}
+}
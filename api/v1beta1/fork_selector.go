@@ -0,0 +1,51 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SelectsService reports whether a Service with the labels is forked by the fork
+func (f *Fork) SelectsService(lbls map[string]string) bool {
+	if f.Spec.Services == nil {
+		return false
+	}
+	return selectorMatches(f.Spec.Services.Selector, lbls)
+}
+
+// SelectsDeployment reports whether a Deployment with the labels can be copied by the fork
+// The Deployment is actually copied only when it is routable from a forked Service
+func (f *Fork) SelectsDeployment(lbls map[string]string) bool {
+	if f.Spec.Deployments == nil {
+		return false
+	}
+	return selectorMatches(f.Spec.Deployments.Selector, lbls)
+}
+
+func selectorMatches(selector *metav1.LabelSelector, lbls map[string]string) bool {
+	// nothing is selected without selector
+	if selector == nil {
+		return false
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return s.Matches(labels.Set(lbls))
+}
@@ -0,0 +1,65 @@
+package v1beta1_test
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+)
+
+func TestForkSelects(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "some-app"}}
+
+	testcases := []struct {
+		name           string
+		spec           forkv1beta1.ForkSpec
+		labels         map[string]string
+		wantService    bool
+		wantDeployment bool
+	}{
+		{
+			name:   "no selectors",
+			labels: map[string]string{"app": "some-app"},
+		},
+		{
+			name: "matching labels",
+			spec: forkv1beta1.ForkSpec{
+				Services:    &forkv1beta1.ForkService{Selector: selector},
+				Deployments: &forkv1beta1.ForkDeployment{Selector: selector},
+			},
+			labels:         map[string]string{"app": "some-app", "role": "web"},
+			wantService:    true,
+			wantDeployment: true,
+		},
+		{
+			name: "labels not matching",
+			spec: forkv1beta1.ForkSpec{
+				Services:    &forkv1beta1.ForkService{Selector: selector},
+				Deployments: &forkv1beta1.ForkDeployment{Selector: selector},
+			},
+			labels: map[string]string{"app": "another-app"},
+		},
+		{
+			name: "only services selector",
+			spec: forkv1beta1.ForkSpec{
+				Services: &forkv1beta1.ForkService{Selector: selector},
+			},
+			labels:      map[string]string{"app": "some-app"},
+			wantService: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			f := &forkv1beta1.Fork{Spec: tc.spec}
+			if got := f.SelectsService(tc.labels); got != tc.wantService {
+				t.Errorf("SelectsService() = %v, want %v", got, tc.wantService)
+			}
+			if got := f.SelectsDeployment(tc.labels); got != tc.wantDeployment {
+				t.Errorf("SelectsDeployment() = %v, want %v", got, tc.wantDeployment)
+			}
+		})
+	}
+}
@@ -39,6 +39,16 @@ type ForkSpec struct {
 
 	GatewayOptions *GatewayOptions `json:"gatewayOptions,omitempty"`
 
+	// Mirror shadows a percentage of requests to the forked Services without the identifier to their copies
+	// Only one fork can mirror requests to a Service at a time
+	// +optional
+	Mirror *MirrorPolicy `json:"mirror,omitempty"`
+
+	// Canary sends a percentage of requests to the forked Services without the identifier to their copies
+	// The split is removed at the deadline
+	// +optional
+	Canary *CanaryPolicy `json:"canary,omitempty"`
+
 	// service selector to copy
 	Services *ForkService `json:"services,omitempty"`
 	// deployment selector to copy
@@ -47,6 +57,35 @@ type ForkSpec struct {
 
 type ForkService struct {
 	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Scopes narrow requests routed to the copies of the selected Services
+	// Requests out of the scope of a Service are sent to the original even with the identifier
+	// +listType=map
+	// +listMapKey=service
+	// +optional
+	Scopes []ServiceScope `json:"scopes,omitempty"`
+}
+
+// ServiceScope is a RouteScope of the copy of a Service
+type ServiceScope struct {
+	// Service is the name of the original Service
+	Service string `json:"service"`
+
+	RouteScope `json:",inline"`
+}
+
+// ScopeOf returns the RouteScope of the copy of the Service, or nil when requests are not narrowed
+func (s *ForkService) ScopeOf(service string) *RouteScope {
+	if s == nil {
+		return nil
+	}
+	for _, scope := range s.Scopes {
+		if scope.Service == service {
+			scope := scope.RouteScope
+			return &scope
+		}
+	}
+	return nil
 }
 
 type ForkDeployment struct {
@@ -84,20 +123,135 @@ type PodSpec struct {
 	Hostname string `json:"hostname,omitempty"`
 }
 
+// CanaryPolicy is a weighted split of requests between the original Services and their copies
+type CanaryPolicy struct {
+	// Weight is the percentage of requests sent to the copies until the first step
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// Steps change the weight over time, in order of `after`
+	// +optional
+	Steps []CanaryStep `json:"steps,omitempty"`
+}
+
+// CanaryStep is a weight of a CanaryPolicy from a point of time
+type CanaryStep struct {
+	// After is how long after the creation of the fork the weight is applied
+	After metav1.Duration `json:"after"`
+
+	// Weight is the percentage of requests sent to the copies
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+}
+
+// GatewayOptions overrides routing options of upstreams which are safe to change per fork
 type GatewayOptions struct {
 	// AddRequestHeaders will add headers in ambassador layer
+	// The header of the fork identifier cannot be overridden
 	AddRequestHeaders map[string]string `json:"addRequestHeaders,omitempty"`
 	AllowUpgrade      []string          `json:"allowUpgrade,omitempty"`
+
+	// AddResponseHeaders will add headers to responses
+	// +optional
+	AddResponseHeaders map[string]string `json:"addResponseHeaders,omitempty"`
+
+	// Timeout overrides the timeout of requests, the longest one is used among forks sharing the identifier
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// IdleTimeout overrides the idle timeout of connections, the longest one is used among forks sharing the identifier
+	// +optional
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+}
+
+const (
+	// IdentifierLabelKey is a label key whose value is the fork identifier
+	IdentifierLabelKey = "fork.k8s.wantedly.com/identifier"
+	// ManagerLabelKey is a label key of resources generated for a ForkManager whose value is the name of the manager
+	ManagerLabelKey = "fork.k8s.wantedly.com/manager"
+	// IdentifierEnvName is an env var injected into forked containers whose value is the fork identifier
+	IdentifierEnvName = "FORK_IDENTIFIER"
+)
+
+// ForkManagerField is the name of the field index of Forks by `spec.manager`
+// Readers backed by a cache must have the index, see controllers.IndexFields
+const ForkManagerField = ".spec.manager"
+
+// ForkPhase is a label for the condition of a Fork at the current time
+type ForkPhase string
+
+const (
+	// ForkPhasePending means resources are generated but copied deployments are not available yet
+	ForkPhasePending ForkPhase = "Pending"
+	// ForkPhaseReady means all resources are generated and copied deployments are available
+	ForkPhaseReady ForkPhase = "Ready"
+	// ForkPhaseDegraded means some resources could not be generated
+	ForkPhaseDegraded ForkPhase = "Degraded"
+	// ForkPhaseExpiring means the deadline has passed and the fork is being removed
+	ForkPhaseExpiring ForkPhase = "Expiring"
+)
+
+// Condition types of Fork
+const (
+	// ForkConditionManagerResolved tells whether the ForkManager referred by `manager` exists
+	ForkConditionManagerResolved = "ManagerResolved"
+	// ForkConditionPolicyCompliant tells whether the fork is within the limits of the ForkManager
+	ForkConditionPolicyCompliant = "PolicyCompliant"
+	// ForkConditionServicesForked tells whether Services and DeploymentCopies are generated
+	ForkConditionServicesForked = "ServicesForked"
+	// ForkConditionDeploymentCopiesReady tells whether Deployments copied by deployment-duplicator are available
+	ForkConditionDeploymentCopiesReady = "DeploymentCopiesReady"
+	// ForkConditionRoutingConfigured tells whether Mappings and VSConfigs are generated
+	ForkConditionRoutingConfigured = "RoutingConfigured"
+)
+
+// ForkResource is a reference to a resource generated for a Fork
+type ForkResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
 }
 
 // ForkStatus defines the observed state of Fork
 type ForkStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Phase summarizes the conditions
+	// +optional
+	Phase ForkPhase `json:"phase,omitempty"`
+
+	// ObservedGeneration is the generation of the spec last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// Resources lists Services, DeploymentCopies, VSConfigs and Mappings generated for the fork
+	// +optional
+	Resources []ForkResource `json:"resources,omitempty"`
+
+	// CanaryWeight is the percentage of requests currently sent to the copies by the canary policy
+	// +optional
+	CanaryWeight int32 `json:"canaryWeight,omitempty"`
+
+	// Mirroring lists the original Services whose requests are currently mirrored to their copies
+	// +optional
+	Mirroring []string `json:"mirroring,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Identifier",type=string,JSONPath=`.spec.identifier`
+//+kubebuilder:printcolumn:name="Manager",type=string,JSONPath=`.spec.manager`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Deadline",type=string,format=date-time,JSONPath=`.spec.deadline`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Fork is the Schema for the forks API
 type Fork struct {
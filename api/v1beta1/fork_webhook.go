@@ -0,0 +1,240 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// ParseManager parses a ForkManager reference of the form `<namespace>/<name>`
+func ParseManager(manager string) (types.NamespacedName, error) {
+	parts := strings.Split(manager, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("manager must be <namespace>/<name>, got %q", manager)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// SetupWebhookWithManager registers the webhooks for Fork
+func (r *Fork) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&ForkDefaulter{Client: mgr.GetClient(), Clock: clock.RealClock{}}).
+		WithValidator(&ForkValidator{Client: mgr.GetClient(), Clock: clock.RealClock{}}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-fork-k8s-wantedly-com-v1beta1-fork,mutating=true,failurePolicy=fail,sideEffects=None,groups=fork.k8s.wantedly.com,resources=forks,verbs=create;update,versions=v1beta1,name=mfork.kb.io,admissionReviewVersions=v1
+
+// ForkDefaulter fills in the same defaults as kubeforkctl does
+// +kubebuilder:object:generate=false
+type ForkDefaulter struct {
+	Client client.Reader
+	Clock  clock.PassiveClock
+}
+
+var _ webhook.CustomDefaulter = &ForkDefaulter{}
+
+// Default implements webhook.CustomDefaulter
+func (d *ForkDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	frk, ok := obj.(*Fork)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a Fork but got %T", obj))
+	}
+
+	if frk.Spec.Identifier != "" {
+		if frk.Labels == nil {
+			frk.Labels = map[string]string{}
+		}
+		frk.Labels[IdentifierLabelKey] = frk.Spec.Identifier
+	}
+
+	if frk.Spec.Deadline == nil {
+		lifetime := DefaultMaxLifetime
+		// an invalid or missing manager is left to the validator
+		if slug, err := ParseManager(frk.Spec.Manager); err == nil {
+			fm := &ForkManager{}
+			if err := d.Client.Get(ctx, slug, fm); err == nil {
+				lifetime = fm.Spec.Lifetime()
+			} else if !apierrors.IsNotFound(err) {
+				return apierrors.NewInternalError(err)
+			}
+		}
+		deadline := metav1.NewTime(d.Clock.Now().Add(lifetime))
+		frk.Spec.Deadline = &deadline
+	}
+
+	if dpl := frk.Spec.Deployments; dpl != nil {
+		if dpl.Replicas == nil {
+			replicas := int32(1)
+			dpl.Replicas = &replicas
+		}
+		if dpl.Template != nil && frk.Spec.Identifier != "" {
+			for i := range dpl.Template.Spec.Containers {
+				setIdentifierEnv(&dpl.Template.Spec.Containers[i], frk.Spec.Identifier)
+			}
+		}
+	}
+
+	return nil
+}
+
+func setIdentifierEnv(c *corev1.Container, identifier string) {
+	for i := range c.Env {
+		if c.Env[i].Name == IdentifierEnvName {
+			c.Env[i].Value = identifier
+			c.Env[i].ValueFrom = nil
+			return
+		}
+	}
+	c.Env = append(c.Env, corev1.EnvVar{Name: IdentifierEnvName, Value: identifier})
+}
+
+//+kubebuilder:webhook:path=/validate-fork-k8s-wantedly-com-v1beta1-fork,mutating=false,failurePolicy=fail,sideEffects=None,groups=fork.k8s.wantedly.com,resources=forks,verbs=create;update,versions=v1beta1,name=vfork.kb.io,admissionReviewVersions=v1
+
+// ForkValidator validates Forks on admission
+// Client must have the field index ForkManagerField when it is backed by a cache
+// +kubebuilder:object:generate=false
+type ForkValidator struct {
+	Client client.Reader
+	Clock  clock.PassiveClock
+}
+
+var _ webhook.CustomValidator = &ForkValidator{}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *ForkValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	frk, ok := obj.(*Fork)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a Fork but got %T", obj))
+	}
+	return v.validate(ctx, frk, nil)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *ForkValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	old, ok := oldObj.(*Fork)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a Fork but got %T", oldObj))
+	}
+	frk, ok := newObj.(*Fork)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a Fork but got %T", newObj))
+	}
+	// updates of metadata, such as the expiry warning annotated by the controller, must pass
+	// even when the manager is deleted or its policy is tightened after the fork is admitted
+	if equality.Semantic.DeepEqual(old.Spec, frk.Spec) {
+		return nil
+	}
+	return v.validate(ctx, frk, old)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *ForkValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *ForkValidator) validate(ctx context.Context, frk, old *Fork) error {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	// an unchanged deadline is allowed to pass so that expiring forks can still be updated
+	deadlineChanged := old == nil || !old.Spec.Deadline.Equal(frk.Spec.Deadline)
+
+	// header values are checked against the preview gateway of the manager once it is found
+	var gateway PreviewGateway
+	if slug, err := ParseManager(frk.Spec.Manager); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("manager"), frk.Spec.Manager, err.Error()))
+	} else {
+		fm := &ForkManager{}
+		if err := v.Client.Get(ctx, slug, fm); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return apierrors.NewInternalError(err)
+			}
+			errs = append(errs, field.NotFound(specPath.Child("manager"), frk.Spec.Manager))
+		} else {
+			gateway = fm.Spec.PreviewGateway
+			forks := &ForkList{}
+			if err := v.Client.List(ctx, forks, client.MatchingFields{ForkManagerField: frk.Spec.Manager}); err != nil {
+				return apierrors.NewInternalError(err)
+			}
+			for _, e := range fm.CheckPolicy(frk, forks.Items, v.Clock.Now()) {
+				if e.Field == specPath.Child("deadline").String() && !deadlineChanged {
+					continue
+				}
+				errs = append(errs, e)
+			}
+		}
+	}
+
+	for _, msg := range validation.IsDNS1123Label(frk.Spec.Identifier) {
+		errs = append(errs, field.Invalid(specPath.Child("identifier"), frk.Spec.Identifier, msg))
+	}
+
+	if deadlineChanged && frk.Spec.Deadline != nil && frk.Spec.Deadline.Time.Before(v.Clock.Now()) {
+		errs = append(errs, field.Invalid(specPath.Child("deadline"), frk.Spec.Deadline.String(), "must not be in the past"))
+	}
+
+	if (frk.Spec.Services == nil || frk.Spec.Services.Selector == nil) &&
+		(frk.Spec.Deployments == nil || frk.Spec.Deployments.Selector == nil) {
+		errs = append(errs, field.Required(specPath, "either services.selector or deployments.selector must be specified"))
+	}
+
+	if frk.Spec.Services != nil {
+		for i, scope := range frk.Spec.Services.Scopes {
+			scopePath := specPath.Child("services", "scopes").Index(i)
+			if scope.Service == "" {
+				errs = append(errs, field.Required(scopePath.Child("service"), ""))
+			}
+			errs = append(errs, scope.RouteScope.Validate(scopePath)...)
+		}
+	}
+
+	if m := frk.Spec.Mirror; m != nil && (m.Percentage < 1 || m.Percentage > 100) {
+		errs = append(errs, field.Invalid(specPath.Child("mirror", "percentage"), m.Percentage, "must be between 1 and 100"))
+	}
+
+	if opts := frk.Spec.GatewayOptions; opts != nil {
+		optsPath := specPath.Child("gatewayOptions")
+		errs = append(errs, ValidateHeaders(optsPath.Child("addRequestHeaders"), opts.AddRequestHeaders, gateway)...)
+		errs = append(errs, ValidateHeaders(optsPath.Child("addResponseHeaders"), opts.AddResponseHeaders, gateway)...)
+	}
+
+	if frk.Spec.Canary != nil {
+		errs = append(errs, frk.Spec.Canary.Validate(specPath.Child("canary"))...)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Fork").GroupKind(), frk.Name, errs)
+}
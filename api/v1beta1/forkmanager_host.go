@@ -0,0 +1,73 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Placeholders of Upstream.HostTemplate
+const (
+	HostTemplateIdentifier = "{identifier}"
+	HostTemplateHost       = "{host}"
+
+	// DefaultHostTemplate is used when the upstream doesn't specify HostTemplate
+	DefaultHostTemplate = HostTemplateIdentifier + "." + HostTemplateHost
+)
+
+func (u Upstream) hostTemplate() string {
+	if u.HostTemplate == "" {
+		return DefaultHostTemplate
+	}
+	return u.HostTemplate
+}
+
+func (u Upstream) renderHost(identifier string) string {
+	return strings.NewReplacer(HostTemplateIdentifier, identifier, HostTemplateHost, u.Host).Replace(u.hostTemplate())
+}
+
+// PreviewHost returns the host requests for the fork identifier are sent to
+// It returns an error when HostTemplate doesn't render a valid DNS subdomain, whose port and case are not checked
+func (u Upstream) PreviewHost(identifier string) (string, error) {
+	if !strings.Contains(u.hostTemplate(), HostTemplateIdentifier) {
+		return "", fmt.Errorf("hostTemplate %q of upstream %s must contain %s", u.hostTemplate(), u.Host, HostTemplateIdentifier)
+	}
+
+	host := u.renderHost(identifier)
+	// hosts of the default template are used as they are, as they have been since before HostTemplate
+	if u.HostTemplate == "" {
+		return host, nil
+	}
+
+	name := strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(name); err == nil {
+		name = h
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+		return "", fmt.Errorf("preview host %q of upstream %s is invalid: %s", host, u.Host, strings.Join(errs, ", "))
+	}
+	return host, nil
+}
+
+// WildcardHost returns a glob pattern matching preview hosts of every identifier
+func (u Upstream) WildcardHost() string {
+	return u.renderHost("*")
+}
@@ -0,0 +1,92 @@
+package v1beta1_test
+
+import (
+	"strings"
+	"testing"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+)
+
+func TestUpstreamPreviewHost(t *testing.T) {
+	testcases := []struct {
+		name         string
+		upstream     forkv1beta1.Upstream
+		want         string
+		wantWildcard string
+		wantErr      bool
+	}{
+		{
+			name:         "default template",
+			upstream:     forkv1beta1.Upstream{Host: "app.example.com"},
+			want:         "some-identifier.app.example.com",
+			wantWildcard: "*.app.example.com",
+		},
+		{
+			name:         "single level template",
+			upstream:     forkv1beta1.Upstream{Host: "app.example.com", HostTemplate: "{identifier}--app.example.com"},
+			want:         "some-identifier--app.example.com",
+			wantWildcard: "*--app.example.com",
+		},
+		{
+			name:         "template with host",
+			upstream:     forkv1beta1.Upstream{Host: "preview.example.com", HostTemplate: "app-{identifier}.{host}"},
+			want:         "app-some-identifier.preview.example.com",
+			wantWildcard: "app-*.preview.example.com",
+		},
+		{
+			name:         "default template with port",
+			upstream:     forkv1beta1.Upstream{Host: "app.example.com:8080"},
+			want:         "some-identifier.app.example.com:8080",
+			wantWildcard: "*.app.example.com:8080",
+		},
+		{
+			name:         "default template with uppercase host",
+			upstream:     forkv1beta1.Upstream{Host: "App.Example.com"},
+			want:         "some-identifier.App.Example.com",
+			wantWildcard: "*.App.Example.com",
+		},
+		{
+			name:         "template with host having port and uppercase letters",
+			upstream:     forkv1beta1.Upstream{Host: "Preview.example.com:8080", HostTemplate: "app-{identifier}.{host}"},
+			want:         "app-some-identifier.Preview.example.com:8080",
+			wantWildcard: "app-*.Preview.example.com:8080",
+		},
+		{
+			name:     "template without identifier",
+			upstream: forkv1beta1.Upstream{Host: "app.example.com", HostTemplate: "{host}"},
+			wantErr:  true,
+		},
+		{
+			name:     "template rendering an invalid host",
+			upstream: forkv1beta1.Upstream{Host: "app.example.com", HostTemplate: "{identifier}_app.example.com"},
+			wantErr:  true,
+		},
+		{
+			name:     "template rendering a too long host",
+			upstream: forkv1beta1.Upstream{Host: "app.example.com", HostTemplate: "{identifier}" + strings.Repeat(".app", 62)},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.upstream.PreviewHost("some-identifier")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if got != tc.want {
+				t.Errorf("PreviewHost() = %q, want %q", got, tc.want)
+			}
+			if got := tc.upstream.WildcardHost(); got != tc.wantWildcard {
+				t.Errorf("WildcardHost() = %q, want %q", got, tc.wantWildcard)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// CheckPolicy returns the limits of the manager that the fork violates
+//
+// forks can be any Forks in the cluster. Only those which refer to the manager and precede the fork are counted,
+// so that the oldest Forks are kept when a limit is exceeded.
+func (fm *ForkManager) CheckPolicy(frk *Fork, forks []Fork, now time.Time) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if len(fm.Spec.AllowedNamespaces) != 0 && !containsString(fm.Spec.AllowedNamespaces, frk.Namespace) {
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "namespace"),
+			fmt.Sprintf("ForkManager %s/%s doesn't allow Forks in namespace %s", fm.Namespace, fm.Name, frk.Namespace)))
+	}
+
+	if fm.Spec.MaxLifetime != nil {
+		max := fm.Spec.MaxLifetime.Duration
+		if frk.Spec.Deadline == nil {
+			errs = append(errs, field.Required(specPath.Child("deadline"), fmt.Sprintf("must be within %s from now", max)))
+		} else if frk.Spec.Deadline.Time.Sub(now) > max {
+			errs = append(errs, field.Invalid(specPath.Child("deadline"), frk.Spec.Deadline.String(), fmt.Sprintf("must be within %s from now", max)))
+		}
+	}
+
+	if fm.Spec.MaxReplicas != nil && frk.Spec.Deployments != nil {
+		replicas := int32(1)
+		if frk.Spec.Deployments.Replicas != nil {
+			replicas = *frk.Spec.Deployments.Replicas
+		}
+		if replicas > *fm.Spec.MaxReplicas {
+			errs = append(errs, field.Invalid(specPath.Child("deployments", "replicas"), replicas, fmt.Sprintf("must be less than or equal to %d", *fm.Spec.MaxReplicas)))
+		}
+	}
+
+	if fm.Spec.MaxForksPerNamespace != nil || fm.Spec.MaxForksPerIdentifier != nil {
+		managerSlug := types.NamespacedName{Namespace: fm.Namespace, Name: fm.Name}.String()
+		var inNamespace, withIdentifier int32
+		for i := range forks {
+			f := &forks[i]
+			if f.Spec.Manager != managerSlug || !f.precedes(frk) {
+				continue
+			}
+			if f.Namespace == frk.Namespace {
+				inNamespace++
+			}
+			if f.Spec.Identifier == frk.Spec.Identifier {
+				withIdentifier++
+			}
+		}
+		if max := fm.Spec.MaxForksPerNamespace; max != nil && inNamespace >= *max {
+			errs = append(errs, field.Forbidden(field.NewPath("metadata", "namespace"),
+				fmt.Sprintf("ForkManager %s allows at most %d Forks in a namespace", managerSlug, *max)))
+		}
+		if max := fm.Spec.MaxForksPerIdentifier; max != nil && withIdentifier >= *max {
+			errs = append(errs, field.Forbidden(specPath.Child("identifier"),
+				fmt.Sprintf("ForkManager %s allows at most %d Forks with the same identifier", managerSlug, *max)))
+		}
+	}
+
+	// with the Prefix match, requests for an identifier are routed to forks whose identifiers are its prefix as well
+	if m := fm.Spec.IdentifierMatch; m != nil && m.Type == MatchTypePrefix {
+		managerSlug := types.NamespacedName{Namespace: fm.Namespace, Name: fm.Name}.String()
+		for i := range forks {
+			f := &forks[i]
+			if f.Spec.Manager != managerSlug || f.Namespace != frk.Namespace || !f.precedes(frk) || f.Spec.Identifier == frk.Spec.Identifier {
+				continue
+			}
+			if strings.HasPrefix(f.Spec.Identifier, frk.Spec.Identifier) || strings.HasPrefix(frk.Spec.Identifier, f.Spec.Identifier) {
+				errs = append(errs, field.Forbidden(specPath.Child("identifier"),
+					fmt.Sprintf("collides with the identifier %q of Fork %s under the Prefix match of ForkManager %s", f.Spec.Identifier, f.Name, managerSlug)))
+			}
+		}
+	}
+
+	return errs
+}
+
+// precedes reports whether f was created before other
+// A Fork which is not created yet comes after all of the existing ones.
+func (f *Fork) precedes(other *Fork) bool {
+	if f.Namespace == other.Namespace && f.Name == other.Name {
+		return false
+	}
+	if created, otherCreated := !f.CreationTimestamp.IsZero(), !other.CreationTimestamp.IsZero(); created != otherCreated {
+		return created
+	}
+	if !f.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return f.CreationTimestamp.Before(&other.CreationTimestamp)
+	}
+	// break ties by name for less flaky behavior
+	if f.Namespace != other.Namespace {
+		return f.Namespace < other.Namespace
+	}
+	return f.Name < other.Name
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
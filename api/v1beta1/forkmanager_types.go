@@ -17,6 +17,8 @@ limitations under the License.
 package v1beta1
 
 import (
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -32,6 +34,182 @@ type Upstream struct {
 
 	// HostRewrite its value will rewrite `Host`
 	HostRewrite string `json:"host_rewrite,omitempty"`
+
+	// HostTemplate is the preview host of a fork identifier, where `{identifier}` and `{host}` are replaced with the identifier and Host
+	// e.g. `{identifier}--app.example.com` or `app-{identifier}.preview.example.com`
+	// Defaults to `{identifier}.{host}`
+	// +optional
+	HostTemplate string `json:"hostTemplate,omitempty"`
+
+	// TLS makes the gateway terminate TLS of the preview domains with a certificate in a Secret
+	// Only supported by the EmissaryV3alpha1 preview gateway
+	// +optional
+	TLS *UpstreamTLS `json:"tls,omitempty"`
+
+	// Routing configures how requests to the preview domains are routed to the upstream
+	// +optional
+	Routing *RoutingOptions `json:"routing,omitempty"`
+}
+
+// Defaults of RoutingOptions
+const (
+	DefaultRoutingPrefix  = "/"
+	DefaultRoutingTimeout = 90 * time.Second
+)
+
+// DefaultAllowUpgrade is a list of protocols allowed to upgrade to when the upstream doesn't specify AllowUpgrade
+var DefaultAllowUpgrade = []string{"websocket"}
+
+// RoutingOptions configures routing of requests to an upstream
+// Options not supported by the preview gateway are ignored
+type RoutingOptions struct {
+	// Prefix is the path prefix of requests routed to the upstream
+	// Defaults to `/`
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Rewrite replaces Prefix of the path, the path is kept as it is when empty
+	// +optional
+	Rewrite string `json:"rewrite,omitempty"`
+
+	// Timeout of a request, defaults to 90s
+	// Not supported by the GatewayAPI preview gateway
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// IdleTimeout of a connection without requests
+	// Only supported by Emissary preview gateways
+	// +optional
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+
+	// GRPC sends requests to the upstream with HTTP/2
+	// Not supported by the GatewayAPI preview gateway
+	// +optional
+	GRPC bool `json:"grpc,omitempty"`
+
+	// AllowUpgrade is a list of protocols allowed to upgrade to, defaults to `websocket`
+	// +optional
+	AllowUpgrade []string `json:"allowUpgrade,omitempty"`
+
+	// CORS is the CORS policy of the preview domains
+	// Not supported by the GatewayAPI preview gateway
+	// +optional
+	CORS *CORSPolicy `json:"cors,omitempty"`
+
+	// RetryPolicy retries requests failed in the upstream
+	// Not supported by the GatewayAPI preview gateway
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// +optional
+	AddRequestHeaders map[string]string `json:"addRequestHeaders,omitempty"`
+	// +optional
+	RemoveRequestHeaders []string `json:"removeRequestHeaders,omitempty"`
+	// Not supported by the GatewayAPI preview gateway
+	// +optional
+	AddResponseHeaders map[string]string `json:"addResponseHeaders,omitempty"`
+	// Not supported by the GatewayAPI preview gateway
+	// +optional
+	RemoveResponseHeaders []string `json:"removeResponseHeaders,omitempty"`
+}
+
+// CORSPolicy configures Cross-Origin Resource Sharing
+type CORSPolicy struct {
+	// +optional
+	Origins []string `json:"origins,omitempty"`
+	// +optional
+	Methods []string `json:"methods,omitempty"`
+	// +optional
+	Headers []string `json:"headers,omitempty"`
+	// +optional
+	ExposedHeaders []string `json:"exposedHeaders,omitempty"`
+	// +optional
+	Credentials bool `json:"credentials,omitempty"`
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// RetryPolicy configures retries of requests
+type RetryPolicy struct {
+	// RetryOn is a condition to retry a request
+	// +kubebuilder:validation:Enum={"5xx","gateway-error","connect-failure","retriable-4xx","refused-stream"}
+	// +optional
+	RetryOn string `json:"retryOn,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	NumRetries int32 `json:"numRetries,omitempty"`
+	// +optional
+	PerTryTimeout *metav1.Duration `json:"perTryTimeout,omitempty"`
+}
+
+// UpstreamTLS configures Hosts serving preview domains of an upstream
+type UpstreamTLS struct {
+	// SecretName is the name of a Secret of type kubernetes.io/tls in the namespace of the ForkManager
+	SecretName string `json:"secretName"`
+
+	// HostMode is Wildcard to generate one Host for `*.<host>`, or PerIdentifier to generate a Host for each `<identifier>.<host>`
+	// Defaults to Wildcard
+	// +optional
+	HostMode HostMode `json:"hostMode,omitempty"`
+}
+
+// HostMode tells how Hosts are generated for an upstream
+// +kubebuilder:validation:Enum=Wildcard;PerIdentifier
+type HostMode string
+
+const (
+	HostModeWildcard      HostMode = "Wildcard"
+	HostModePerIdentifier HostMode = "PerIdentifier"
+)
+
+// PreviewGateway is a kind of gateway serving preview domains of Forks
+// +kubebuilder:validation:Enum=EmissaryV2;EmissaryV3alpha1;Ingress;GatewayAPI
+type PreviewGateway string
+
+const (
+	// PreviewGatewayEmissaryV2 generates getambassador.io/v2 Mappings
+	PreviewGatewayEmissaryV2 PreviewGateway = "EmissaryV2"
+	// PreviewGatewayEmissaryV3alpha1 generates getambassador.io/v3alpha1 Mappings, and Hosts of upstreams with TLS
+	PreviewGatewayEmissaryV3alpha1 PreviewGateway = "EmissaryV3alpha1"
+	// PreviewGatewayIngress generates networking.k8s.io/v1 Ingresses for ingress-nginx
+	PreviewGatewayIngress PreviewGateway = "Ingress"
+	// PreviewGatewayGatewayAPI generates gateway.networking.k8s.io/v1beta1 HTTPRoutes attached to Gateways
+	PreviewGatewayGatewayAPI PreviewGateway = "GatewayAPI"
+)
+
+// IngressGateway configures Ingresses generated by the Ingress preview gateway
+// Upstreams must have Original naming a Service in the namespace of the ForkManager
+// Headers are added with the configuration-snippet annotation, which ingress-nginx disables by default
+// Set `allow-snippet-annotations: "true"` in the ConfigMap of ingress-nginx, otherwise requests reach upstreams without the identifier header
+type IngressGateway struct {
+	// ClassName is the IngressClass of the Ingresses
+	// +optional
+	ClassName *string `json:"className,omitempty"`
+
+	// Annotations are added to the Ingresses, e.g. to issue certificates with cert-manager
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// GatewayAPIGateway configures HTTPRoutes generated by the GatewayAPI preview gateway
+// Upstreams must have Original naming a Service
+type GatewayAPIGateway struct {
+	// ParentRefs are Gateways the HTTPRoutes are attached to
+	// +kubebuilder:validation:MinItems=1
+	ParentRefs []GatewayReference `json:"parentRefs"`
+}
+
+// GatewayReference refers to a listener of a Gateway
+type GatewayReference struct {
+	Name string `json:"name"`
+
+	// Namespace of the Gateway, defaults to the namespace of the ForkManager
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName is the name of a listener of the Gateway
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
 }
 
 // ForkManagerSpec defines the desired state of ForkManager
@@ -46,14 +224,131 @@ type ForkManagerSpec struct {
 	// e.g. When headerKey = "X-Fork-Identifier" and the id is "some-id", Ambassador will add `X-Fork-Identifier: some-id` when accessed with `some-id` subdomain
 	HeaderKey string `json:"headerKey"`
 
+	// IdentifierMatch tells how VSConfigs of the forks match requests carrying the identifier in HeaderKey
+	// Defaults to the Exact header match
+	// +optional
+	IdentifierMatch *IdentifierMatch `json:"identifierMatch,omitempty"`
+
 	// requests with header `Host: <fork-identifier>.<upstream-host>` will be propagated to `<upstream-host>`
 	Upstreams []Upstream `json:"upstreams,omitempty"`
+
+	// MaxLifetime is used to fill in the deadline of a Fork created without one
+	// Defaults to 8h
+	// When specified, the deadline of a Fork must not be further than MaxLifetime from now
+	// +optional
+	MaxLifetime *metav1.Duration `json:"maxLifetime,omitempty"`
+
+	// MaxReplicas limits `deployments.replicas` of a Fork
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// MaxForksPerNamespace limits the number of Forks in a namespace which refer to the manager
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxForksPerNamespace *int32 `json:"maxForksPerNamespace,omitempty"`
+
+	// MaxForksPerIdentifier limits the number of Forks sharing an identifier which refer to the manager
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxForksPerIdentifier *int32 `json:"maxForksPerIdentifier,omitempty"`
+
+	// RoutingBackend is the backend VSConfigs generated for Forks of the manager are rendered with
+	// Defaults to the backend given to the controller with `--routing-backend`
+	// +optional
+	RoutingBackend RoutingBackend `json:"routingBackend,omitempty"`
+
+	// AllowedNamespaces is a list of namespaces where Forks can refer to the manager
+	// All namespaces are allowed when empty
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// PreviewGateway is the gateway resources routing preview domains to the upstreams are generated for
+	// Defaults to EmissaryV2
+	// +optional
+	PreviewGateway PreviewGateway `json:"previewGateway,omitempty"`
+
+	// Ingress configures the Ingress preview gateway
+	// +optional
+	Ingress *IngressGateway `json:"ingress,omitempty"`
+
+	// GatewayAPI configures the GatewayAPI preview gateway, required by it
+	// +optional
+	GatewayAPI *GatewayAPIGateway `json:"gatewayAPI,omitempty"`
+}
+
+// IdentifierMatch is copied to VSConfigs generated for Forks of a ForkManager
+type IdentifierMatch struct {
+	// Type defaults to Exact
+	// +optional
+	Type MatchType `json:"type,omitempty"`
+
+	// Pattern is a regular expression where `{identifier}` is replaced with the identifier, required by the Regex type
+	// e.g. `^(.+,)?{identifier}(,.+)?$` to find the identifier in a comma separated list
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+
+	// Name is the name of the cookie or the query parameter carrying the identifier for the Cookie and QueryParam types
+	// Defaults to HeaderKey
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// DefaultMaxLifetime is the lifetime of a Fork when the ForkManager doesn't specify MaxLifetime
+const DefaultMaxLifetime = 8 * time.Hour
+
+// Lifetime returns MaxLifetime or DefaultMaxLifetime when it is not set
+func (s ForkManagerSpec) Lifetime() time.Duration {
+	if s.MaxLifetime == nil {
+		return DefaultMaxLifetime
+	}
+	return s.MaxLifetime.Duration
+}
+
+// Condition types of UpstreamStatus
+const (
+	// UpstreamConditionMappingsReady tells whether Mappings for the upstream are created or updated
+	UpstreamConditionMappingsReady = "MappingsReady"
+)
+
+// IdentifierStatus describes what is served for a fork identifier
+type IdentifierStatus struct {
+	Identifier string `json:"identifier"`
+	// Forks is the number of Forks which have the identifier
+	Forks int `json:"forks"`
+	// Mappings is a list of names of Mappings, or resources of the preview gateway in place of them, generated for the identifier
+	// +optional
+	Mappings []string `json:"mappings,omitempty"`
+	// Hosts is a list of preview hostnames for the identifier
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// UpstreamStatus describes the health of Mappings for an upstream
+type UpstreamStatus struct {
+	Host string `json:"host"`
+
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 // ForkManagerStatus defines the observed state of ForkManager
 type ForkManagerStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the generation of the spec last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Identifiers lists fork identifiers currently served by the manager
+	// +optional
+	Identifiers []IdentifierStatus `json:"identifiers,omitempty"`
+
+	// Upstreams reports Mapping health for each upstream
+	// +optional
+	Upstreams []UpstreamStatus `json:"upstreams,omitempty"`
 }
 
 //+kubebuilder:object:root=true
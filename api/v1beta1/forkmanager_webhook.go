@@ -0,0 +1,149 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the webhooks for ForkManager
+func (r *ForkManager) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&ForkManagerValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-fork-k8s-wantedly-com-v1beta1-forkmanager,mutating=false,failurePolicy=fail,sideEffects=None,groups=fork.k8s.wantedly.com,resources=forkmanagers,verbs=create;update,versions=v1beta1,name=vforkmanager.kb.io,admissionReviewVersions=v1
+
+// ForkManagerValidator validates ForkManagers on admission
+// +kubebuilder:object:generate=false
+type ForkManagerValidator struct{}
+
+var _ webhook.CustomValidator = &ForkManagerValidator{}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *ForkManagerValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return v.validate(obj)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *ForkManagerValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	return v.validate(newObj)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *ForkManagerValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *ForkManagerValidator) validate(obj runtime.Object) error {
+	fm, ok := obj.(*ForkManager)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a ForkManager but got %T", obj))
+	}
+
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if fm.Spec.HeaderKey == "" {
+		errs = append(errs, field.Required(specPath.Child("headerKey"), ""))
+	} else {
+		for _, msg := range IsHeaderName(fm.Spec.HeaderKey, fm.Spec.PreviewGateway) {
+			errs = append(errs, field.Invalid(specPath.Child("headerKey"), fm.Spec.HeaderKey, msg))
+		}
+	}
+
+	if m := fm.Spec.IdentifierMatch; m != nil && m.Type == MatchTypeRegex {
+		// identifiers are unknown on admission, so the pattern is checked with the shortest one
+		if _, err := (VSConfigSpec{MatchType: m.Type, Pattern: m.Pattern, HeaderValue: "x"}).HeaderRegex(); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("identifierMatch", "pattern"), m.Pattern, err.Error()))
+		}
+	}
+	if m := fm.Spec.IdentifierMatch; m != nil {
+		errs = append(errs, validateParamName(specPath.Child("identifierMatch", "name"), m.Type, m.Name)...)
+	}
+
+	if fm.Spec.MaxLifetime != nil && fm.Spec.MaxLifetime.Duration <= 0 {
+		errs = append(errs, field.Invalid(specPath.Child("maxLifetime"), fm.Spec.MaxLifetime.Duration.String(), "must be positive"))
+	}
+
+	seen := map[string]bool{}
+	for i, u := range fm.Spec.Upstreams {
+		hostPath := specPath.Child("upstreams").Index(i).Child("host")
+		if u.Host == "" {
+			errs = append(errs, field.Required(hostPath, ""))
+			continue
+		}
+		if seen[u.Host] {
+			errs = append(errs, field.Duplicate(hostPath, u.Host))
+		}
+		seen[u.Host] = true
+
+		// identifiers are unknown on admission, so the template is checked with the shortest one
+		if _, err := u.PreviewHost("x"); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("upstreams").Index(i).Child("hostTemplate"), u.HostTemplate, err.Error()))
+		}
+
+		if u.TLS != nil {
+			tlsPath := specPath.Child("upstreams").Index(i).Child("tls")
+			if fm.Spec.PreviewGateway != PreviewGatewayEmissaryV3alpha1 {
+				errs = append(errs, field.Forbidden(tlsPath, fmt.Sprintf("only supported by the %s preview gateway", PreviewGatewayEmissaryV3alpha1)))
+			}
+			if u.TLS.SecretName == "" {
+				errs = append(errs, field.Required(tlsPath.Child("secretName"), ""))
+			}
+		}
+
+		if r := u.Routing; r != nil {
+			routingPath := specPath.Child("upstreams").Index(i).Child("routing")
+			if r.Prefix != "" && !strings.HasPrefix(r.Prefix, "/") {
+				errs = append(errs, field.Invalid(routingPath.Child("prefix"), r.Prefix, "must start with /"))
+			}
+			if r.Rewrite != "" && !strings.HasPrefix(r.Rewrite, "/") {
+				errs = append(errs, field.Invalid(routingPath.Child("rewrite"), r.Rewrite, "must start with /"))
+			}
+			if r.Timeout != nil && r.Timeout.Duration <= 0 {
+				errs = append(errs, field.Invalid(routingPath.Child("timeout"), r.Timeout.Duration.String(), "must be positive"))
+			}
+			if r.IdleTimeout != nil && r.IdleTimeout.Duration <= 0 {
+				errs = append(errs, field.Invalid(routingPath.Child("idleTimeout"), r.IdleTimeout.Duration.String(), "must be positive"))
+			}
+			errs = append(errs, ValidateHeaders(routingPath.Child("addRequestHeaders"), r.AddRequestHeaders, fm.Spec.PreviewGateway)...)
+			errs = append(errs, ValidateHeaderNames(routingPath.Child("removeRequestHeaders"), r.RemoveRequestHeaders, fm.Spec.PreviewGateway)...)
+			errs = append(errs, ValidateHeaders(routingPath.Child("addResponseHeaders"), r.AddResponseHeaders, fm.Spec.PreviewGateway)...)
+			errs = append(errs, ValidateHeaderNames(routingPath.Child("removeResponseHeaders"), r.RemoveResponseHeaders, fm.Spec.PreviewGateway)...)
+		}
+	}
+
+	if fm.Spec.PreviewGateway == PreviewGatewayGatewayAPI && (fm.Spec.GatewayAPI == nil || len(fm.Spec.GatewayAPI.ParentRefs) == 0) {
+		errs = append(errs, field.Required(specPath.Child("gatewayAPI", "parentRefs"), fmt.Sprintf("required by the %s preview gateway", PreviewGatewayGatewayAPI)))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ForkManager").GroupKind(), fm.Name, errs)
+}
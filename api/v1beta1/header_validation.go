@@ -0,0 +1,92 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// httpToken matches a token of RFC 7230, which header names must be
+var httpToken = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// nginxUnsafeChars would break out of a quoted string in nginx configuration or expand a variable
+// nginx has no escape for `$`, so values with them are rejected instead of escaped
+const nginxUnsafeChars = "$\";\\"
+
+// IsHeaderName returns messages why the name can't be given to the preview gateway, or nothing when it can
+func IsHeaderName(name string, gateway PreviewGateway) []string {
+	if !httpToken.MatchString(name) {
+		return []string{"must be a token of RFC 7230, consisting of alphanumerics and !#$%&'*+-.^_`|~"}
+	}
+	if gateway == PreviewGatewayIngress && strings.ContainsAny(name, nginxUnsafeChars) {
+		return []string{fmt.Sprintf("must not contain any of %q with the %s preview gateway", nginxUnsafeChars, PreviewGatewayIngress)}
+	}
+	return nil
+}
+
+// IsHeaderValue returns messages why the value can't be given to the preview gateway, or nothing when it can
+// Values are written into configuration snippets of ingress-nginx by the Ingress preview gateway
+func IsHeaderValue(value string, gateway PreviewGateway) []string {
+	var msgs []string
+	if strings.ContainsAny(value, "\r\n") {
+		msgs = append(msgs, "must not contain line breaks")
+	}
+	if gateway == PreviewGatewayIngress && strings.ContainsAny(value, nginxUnsafeChars) {
+		msgs = append(msgs, fmt.Sprintf("must not contain any of %q with the %s preview gateway", nginxUnsafeChars, PreviewGatewayIngress))
+	}
+	return msgs
+}
+
+// ValidateHeaderNames returns errors of names which can't be given to the preview gateway
+func ValidateHeaderNames(path *field.Path, names []string, gateway PreviewGateway) field.ErrorList {
+	var errs field.ErrorList
+	for i, name := range names {
+		for _, msg := range IsHeaderName(name, gateway) {
+			errs = append(errs, field.Invalid(path.Index(i), name, msg))
+		}
+	}
+	return errs
+}
+
+// ValidateHeaders returns errors of headers which can't be given to the preview gateway
+func ValidateHeaders(path *field.Path, headers map[string]string, gateway PreviewGateway) field.ErrorList {
+	var errs field.ErrorList
+	for _, name := range sortedHeaderNames(headers) {
+		for _, msg := range IsHeaderName(name, gateway) {
+			errs = append(errs, field.Invalid(path.Key(name), name, msg))
+		}
+		for _, msg := range IsHeaderValue(headers[name], gateway) {
+			errs = append(errs, field.Invalid(path.Key(name), headers[name], msg))
+		}
+	}
+	return errs
+}
+
+// sortedHeaderNames returns names of the headers in order for stable errors
+func sortedHeaderNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
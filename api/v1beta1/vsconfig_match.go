@@ -0,0 +1,105 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// MatchPatternIdentifier is the placeholder of VSConfigSpec.Pattern replaced with HeaderValue
+const MatchPatternIdentifier = "{identifier}"
+
+// Match returns MatchType, or Exact when it is not set
+func (s VSConfigSpec) Match() MatchType {
+	if s.MatchType == "" {
+		return MatchTypeExact
+	}
+	return s.MatchType
+}
+
+// ParamName returns the name of the cookie or the query parameter matched, which defaults to HeaderName
+func (s VSConfigSpec) ParamName() string {
+	if s.MatchName == "" {
+		return s.HeaderName
+	}
+	return s.MatchName
+}
+
+// validateParamName checks the name of the cookie or the query parameter given to the match type
+// Cookie names are tokens of RFC 7230 as well as header names, and so are query parameter names to carry identifiers safely
+func validateParamName(path *field.Path, matchType MatchType, name string) field.ErrorList {
+	if name == "" {
+		return nil
+	}
+	if matchType != MatchTypeCookie && matchType != MatchTypeQueryParam {
+		return field.ErrorList{field.Forbidden(path, fmt.Sprintf("only used by the %s and %s types", MatchTypeCookie, MatchTypeQueryParam))}
+	}
+	var errs field.ErrorList
+	for _, msg := range IsHeaderName(name, "") {
+		errs = append(errs, field.Invalid(path, name, msg))
+	}
+	return errs
+}
+
+// HeaderRegex renders Pattern into the regular expression the header is matched with by the Regex MatchType
+// It returns an error when Pattern doesn't contain the identifier or doesn't compile
+func (s VSConfigSpec) HeaderRegex() (string, error) {
+	if !strings.Contains(s.Pattern, MatchPatternIdentifier) {
+		return "", fmt.Errorf("pattern %q must contain %s", s.Pattern, MatchPatternIdentifier)
+	}
+
+	re := strings.ReplaceAll(s.Pattern, MatchPatternIdentifier, regexp.QuoteMeta(s.HeaderValue))
+	if _, err := regexp.Compile(re); err != nil {
+		return "", fmt.Errorf("pattern %q is invalid: %s", s.Pattern, err)
+	}
+	return re, nil
+}
+
+// httpMethod is a token of RFC 7230 in upper case
+var httpMethod = regexp.MustCompile("^[A-Z]+$")
+
+// Validate returns errors of constraints of the scope
+func (s RouteScope) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if s.URIPrefix != "" && s.URIRegex != "" {
+		errs = append(errs, field.Forbidden(path.Child("uriRegex"), "uriPrefix and uriRegex are exclusive"))
+	}
+	if s.URIPrefix != "" && !strings.HasPrefix(s.URIPrefix, "/") {
+		errs = append(errs, field.Invalid(path.Child("uriPrefix"), s.URIPrefix, "must start with /"))
+	}
+	if s.URIRegex != "" {
+		if _, err := regexp.Compile(s.URIRegex); err != nil {
+			errs = append(errs, field.Invalid(path.Child("uriRegex"), s.URIRegex, err.Error()))
+		}
+	}
+	for i, method := range s.Methods {
+		if !httpMethod.MatchString(method) {
+			errs = append(errs, field.Invalid(path.Child("methods").Index(i), method, "must be an HTTP method in upper case"))
+		}
+	}
+	if s.Port != nil {
+		for _, msg := range validation.IsValidPortNum(int(*s.Port)) {
+			errs = append(errs, field.Invalid(path.Child("port"), *s.Port, msg))
+		}
+	}
+	return errs
+}
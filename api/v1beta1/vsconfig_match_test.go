@@ -0,0 +1,62 @@
+package v1beta1_test
+
+import (
+	"testing"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+)
+
+func TestVSConfigSpecHeaderRegex(t *testing.T) {
+	testcases := []struct {
+		name    string
+		pattern string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "identifier in a list",
+			pattern: "^(.+,)?{identifier}(,.+)?$",
+			value:   "some-identifier",
+			want:    "^(.+,)?some-identifier(,.+)?$",
+		},
+		{
+			name:    "identifier is quoted",
+			pattern: "^{identifier}$",
+			value:   "some.identifier",
+			want:    `^some\.identifier$`,
+		},
+		{
+			name:    "pattern without identifier",
+			pattern: "^some-identifier$",
+			value:   "some-identifier",
+			wantErr: true,
+		},
+		{
+			name:    "pattern not compiling",
+			pattern: "^({identifier}$",
+			value:   "some-identifier",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			spec := forkv1beta1.VSConfigSpec{MatchType: forkv1beta1.MatchTypeRegex, Pattern: tc.pattern, HeaderValue: tc.value}
+			got, err := spec.HeaderRegex()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error but got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if got != tc.want {
+				t.Errorf("HeaderRegex() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -30,22 +30,182 @@ type VSConfigSpec struct {
 
 	// Target Kubernetes service name to trap requests
 	Host string `json:"host"`
-	// service to route when receiving http header `HeaderName: HeaderValue`
+	// service to route when receiving http header `HeaderName: HeaderValue`, or requests matched with MatchType
 	Service string `json:"service"`
 	// http header name to check
 	HeaderName string `json:"headerName"`
 	// http header value to route to Service
 	HeaderValue string `json:"headerValue"`
+	// MatchType tells how requests are matched with HeaderValue
+	// Defaults to Exact
+	// +optional
+	MatchType MatchType `json:"matchType,omitempty"`
+	// Pattern is a regular expression the header is matched with, where `{identifier}` is replaced with HeaderValue
+	// Required by the Regex MatchType
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+	// MatchName is the name of the cookie or the query parameter matched by the Cookie and QueryParam MatchType
+	// Defaults to HeaderName
+	// +optional
+	MatchName string `json:"matchName,omitempty"`
+	// Scope narrows requests routed to Service, requests out of the scope are sent to Host even with the header
+	// +optional
+	Scope *RouteScope `json:"scope,omitempty"`
+	// Mirror shadows requests to Host without the header to Service as well
+	// Not supported by the GatewayAPI backend
+	// +optional
+	Mirror *MirrorPolicy `json:"mirror,omitempty"`
+	// Weight is the percentage of requests to Host without the header sent to Service instead
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Weight int32 `json:"weight,omitempty"`
+	// Backend is the kind of resources the route is rendered into
+	// Defaults to the backend given to the controller with `--routing-backend`
+	// +optional
+	Backend RoutingBackend `json:"backend,omitempty"`
 }
 
+// MirrorPolicy shadows baseline traffic to a fork, whose responses are discarded
+// Mirrored requests are marked by the Host header suffixed with `-shadow`, which Istio appends
+type MirrorPolicy struct {
+	// Percentage is the percentage of requests mirrored
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	Percentage int32 `json:"percentage"`
+}
+
+// RouteScope narrows requests routed to a fork of a Service
+// Every constraint given must be satisfied
+type RouteScope struct {
+	// URIPrefix is a prefix of paths, e.g. `/api/v2/search` or `/pkg.Search/` for methods of a gRPC service
+	// +optional
+	URIPrefix string `json:"uriPrefix,omitempty"`
+	// URIRegex is a regular expression of paths, exclusive with URIPrefix
+	// +optional
+	URIRegex string `json:"uriRegex,omitempty"`
+	// Methods are HTTP methods, any of which is matched
+	// +optional
+	Methods []string `json:"methods,omitempty"`
+	// Port is a port of the Service requests are sent to
+	// Not supported by the GatewayAPI backend
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+}
+
+// RoutingBackend is a kind of resources VSConfigs are rendered into
+// +kubebuilder:validation:Enum=Istio;GatewayAPI
+type RoutingBackend string
+
+const (
+	// RoutingBackendIstio renders Istio VirtualServices
+	RoutingBackendIstio RoutingBackend = "Istio"
+	// RoutingBackendGatewayAPI renders Gateway API HTTPRoutes attached to the host Service (GAMMA)
+	RoutingBackendGatewayAPI RoutingBackend = "GatewayAPI"
+)
+
+// MatchType is a way requests carry a fork identifier
+// Cookie and QueryParam also match the header exactly, so that requests through preview gateways and services propagating the header are routed
+// +kubebuilder:validation:Enum=Exact;Prefix;Regex;Cookie;QueryParam
+type MatchType string
+
+const (
+	// MatchTypeExact matches the header `HeaderName: HeaderValue`
+	MatchTypeExact MatchType = "Exact"
+	// MatchTypePrefix matches the header HeaderName whose value starts with HeaderValue
+	// A value matches every VSConfig whose HeaderValue is its prefix, so ForkManagers reject Forks with colliding identifiers
+	MatchTypePrefix MatchType = "Prefix"
+	// MatchTypeRegex matches the header HeaderName whose value matches Pattern
+	MatchTypeRegex MatchType = "Regex"
+	// MatchTypeCookie matches the cookie `MatchName=HeaderValue` in the Cookie header
+	MatchTypeCookie MatchType = "Cookie"
+	// MatchTypeQueryParam matches the query parameter `MatchName=HeaderValue`
+	MatchTypeQueryParam MatchType = "QueryParam"
+)
+
+// Annotations of Services targeted by VSConfigs to keep policies of their traffic with the Istio backend
+const (
+	// BaseVirtualServiceAnnotationKey names a VirtualService in the namespace of the Service which routes of VSConfigs are merged into
+	// The VirtualService is left owned by the user, and routes other than the ones of VSConfigs are kept
+	BaseVirtualServiceAnnotationKey = "fork.k8s.wantedly.com/base-virtual-service"
+	// RouteTemplateAnnotationKey is a JSON of an Istio HTTPRoute whose policies routes of the VirtualService owned by the Service inherit
+	RouteTemplateAnnotationKey = "fork.k8s.wantedly.com/route-template"
+)
+
+// VSConfigHostField is the name of the field index of VSConfigs by `spec.host`
+// Readers backed by a cache must have the index, see controllers.IndexFields
+const VSConfigHostField = ".spec.host"
+
+// VSConfigSkipReason tells why a VSConfig is not rendered into a VirtualService or HTTPRoute
+type VSConfigSkipReason string
+
+const (
+	// VSConfigReasonHostNotFound means there is no Service named `host`
+	VSConfigReasonHostNotFound VSConfigSkipReason = "HostServiceNotFound"
+	// VSConfigReasonEmptyHeaderValue means `headerValue` is empty, which would match any request with the header
+	VSConfigReasonEmptyHeaderValue VSConfigSkipReason = "EmptyHeaderValue"
+	// VSConfigReasonBaseNotFound means the VirtualService named by the base-virtual-service annotation of the host is missing
+	VSConfigReasonBaseNotFound VSConfigSkipReason = "BaseVirtualServiceNotFound"
+	// VSConfigReasonInvalidPattern means `pattern` of the Regex matchType doesn't render a valid regular expression
+	VSConfigReasonInvalidPattern VSConfigSkipReason = "InvalidPattern"
+	// VSConfigReasonUnsupportedScope means `scope` can't be rendered with the backend
+	VSConfigReasonUnsupportedScope VSConfigSkipReason = "UnsupportedScope"
+	// VSConfigReasonUnsupportedMirror means `mirror` can't be rendered with the backend
+	VSConfigReasonUnsupportedMirror VSConfigSkipReason = "UnsupportedMirror"
+	// VSConfigReasonConflictingMirror means another VSConfig already mirrors requests to the host
+	VSConfigReasonConflictingMirror VSConfigSkipReason = "ConflictingMirror"
+	// VSConfigReasonConflictingCanary means another VSConfig already sends a weight of requests to the host elsewhere
+	VSConfigReasonConflictingCanary VSConfigSkipReason = "ConflictingCanary"
+	// VSConfigReasonConflictingIdentifier means another VSConfig already routes the same header to the host
+	VSConfigReasonConflictingIdentifier VSConfigSkipReason = "ConflictingIdentifier"
+)
+
 // VSConfigStatus defines the observed state of VSConfig
 type VSConfigStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the generation of the spec last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Rendered tells whether the route is present in a VirtualService or HTTPRoute
+	Rendered bool `json:"rendered,omitempty"`
+
+	// Backend is the routing backend the route is rendered with
+	// +optional
+	Backend RoutingBackend `json:"backend,omitempty"`
+
+	// VirtualService is the name of the VirtualService the route is rendered into
+	// +optional
+	VirtualService string `json:"virtualService,omitempty"`
+
+	// HTTPRoute is the name of the HTTPRoute the route is rendered into
+	// +optional
+	HTTPRoute string `json:"httpRoute,omitempty"`
+
+	// Mirroring tells whether requests to the host are mirrored to the service
+	// +optional
+	Mirroring bool `json:"mirroring,omitempty"`
+
+	// RouteIndex is the position of the route in `http` of the VirtualService or `rules` of the HTTPRoute
+	// +optional
+	RouteIndex *int32 `json:"routeIndex,omitempty"`
+
+	// Reason tells why the route is not rendered
+	// +optional
+	Reason VSConfigSkipReason `json:"reason,omitempty"`
+
+	// Message is a human readable detail of Reason
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.host`
+//+kubebuilder:printcolumn:name="Service",type=string,JSONPath=`.spec.service`
+//+kubebuilder:printcolumn:name="Rendered",type=boolean,JSONPath=`.status.rendered`
+//+kubebuilder:printcolumn:name="Backend",type=string,JSONPath=`.status.backend`
+//+kubebuilder:printcolumn:name="VirtualService",type=string,JSONPath=`.status.virtualService`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.reason`
 
 // VSConfig is the Schema for the vsconfigs API
 type VSConfig struct {
@@ -0,0 +1,122 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the webhooks for VSConfig
+func (r *VSConfig) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&VSConfigValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-fork-k8s-wantedly-com-v1beta1-vsconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=fork.k8s.wantedly.com,resources=vsconfigs,verbs=create;update,versions=v1beta1,name=vvsconfig.kb.io,admissionReviewVersions=v1
+
+// VSConfigValidator validates VSConfigs on admission
+// +kubebuilder:object:generate=false
+type VSConfigValidator struct{}
+
+var _ webhook.CustomValidator = &VSConfigValidator{}
+
+// ValidateCreate implements webhook.CustomValidator
+func (v *VSConfigValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return v.validate(obj)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (v *VSConfigValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	old, ok := oldObj.(*VSConfig)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a VSConfig but got %T", oldObj))
+	}
+	vsc, ok := newObj.(*VSConfig)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a VSConfig but got %T", newObj))
+	}
+	// updates of metadata, such as finalizers and labels set by the controller, must pass
+	// even when the VSConfig was created before the current validation
+	if equality.Semantic.DeepEqual(old.Spec, vsc.Spec) {
+		return nil
+	}
+	return v.validate(vsc)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (v *VSConfigValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *VSConfigValidator) validate(obj runtime.Object) error {
+	vsc, ok := obj.(*VSConfig)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a VSConfig but got %T", obj))
+	}
+
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if vsc.Spec.Host == "" {
+		errs = append(errs, field.Required(specPath.Child("host"), ""))
+	}
+	if vsc.Spec.Service == "" {
+		errs = append(errs, field.Required(specPath.Child("service"), ""))
+	}
+	if vsc.Spec.HeaderName == "" {
+		errs = append(errs, field.Required(specPath.Child("headerName"), ""))
+	}
+	// headerValue is a fork identifier
+	for _, msg := range validation.IsDNS1123Label(vsc.Spec.HeaderValue) {
+		errs = append(errs, field.Invalid(specPath.Child("headerValue"), vsc.Spec.HeaderValue, msg))
+	}
+
+	if vsc.Spec.Scope != nil {
+		errs = append(errs, vsc.Spec.Scope.Validate(specPath.Child("scope"))...)
+	}
+
+	if m := vsc.Spec.Mirror; m != nil && (m.Percentage < 1 || m.Percentage > 100) {
+		errs = append(errs, field.Invalid(specPath.Child("mirror", "percentage"), m.Percentage, "must be between 1 and 100"))
+	}
+
+	if vsc.Spec.Weight < 0 || vsc.Spec.Weight > 100 {
+		errs = append(errs, field.Invalid(specPath.Child("weight"), vsc.Spec.Weight, "must be between 0 and 100"))
+	}
+
+	if vsc.Spec.Match() == MatchTypeRegex {
+		if _, err := vsc.Spec.HeaderRegex(); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("pattern"), vsc.Spec.Pattern, err.Error()))
+		}
+	}
+	errs = append(errs, validateParamName(specPath.Child("matchName"), vsc.Spec.Match(), vsc.Spec.MatchName)...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("VSConfig").GroupKind(), vsc.Name, errs)
+}
@@ -0,0 +1,579 @@
+package v1beta1_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+)
+
+func TestValidateCreate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := forkv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	maxReplicas, maxForks := int32(2), int32(1)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&forkv1beta1.ForkManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "ambassador"},
+			Spec:       forkv1beta1.ForkManagerSpec{HeaderKey: "fork-identifier"},
+		},
+		&forkv1beta1.ForkManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "limited", Namespace: "ambassador"},
+			Spec: forkv1beta1.ForkManagerSpec{
+				HeaderKey:             "fork-identifier",
+				MaxLifetime:           &metav1.Duration{Duration: time.Hour},
+				MaxReplicas:           &maxReplicas,
+				MaxForksPerIdentifier: &maxForks,
+				AllowedNamespaces:     []string{"some-namespace"},
+			},
+		},
+		&forkv1beta1.ForkManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "ambassador"},
+			Spec:       forkv1beta1.ForkManagerSpec{HeaderKey: "fork-identifier", PreviewGateway: forkv1beta1.PreviewGatewayIngress},
+		},
+		&forkv1beta1.ForkManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "prefix", Namespace: "ambassador"},
+			Spec: forkv1beta1.ForkManagerSpec{
+				HeaderKey:       "fork-identifier",
+				IdentifierMatch: &forkv1beta1.IdentifierMatch{Type: forkv1beta1.MatchTypePrefix},
+			},
+		},
+		&forkv1beta1.Fork{
+			ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "another-namespace"},
+			Spec:       forkv1beta1.ForkSpec{Manager: "ambassador/limited", Identifier: "existing-identifier"},
+		},
+		&forkv1beta1.Fork{
+			ObjectMeta: metav1.ObjectMeta{Name: "some", Namespace: "some-namespace"},
+			Spec:       forkv1beta1.ForkSpec{Manager: "ambassador/prefix", Identifier: "some"},
+		},
+	).Build()
+
+	forkValidator := &forkv1beta1.ForkValidator{Client: fakeClient, Clock: clock.NewFakePassiveClock(now)}
+	genFork := func(mutate func(*forkv1beta1.Fork)) runtime.Object {
+		deadline := metav1.NewTime(now.Add(10 * time.Minute))
+		frk := &forkv1beta1.Fork{
+			ObjectMeta: metav1.ObjectMeta{Name: "some-identifier", Namespace: "some-namespace"},
+			Spec: forkv1beta1.ForkSpec{
+				Manager:    "ambassador/default",
+				Identifier: "some-identifier",
+				Deadline:   &deadline,
+				Services: &forkv1beta1.ForkService{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "some-app"}},
+				},
+			},
+		}
+		mutate(frk)
+		return frk
+	}
+	genForkManager := func(headerKey string, hosts ...string) runtime.Object {
+		fm := &forkv1beta1.ForkManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "ambassador"},
+			Spec:       forkv1beta1.ForkManagerSpec{HeaderKey: headerKey},
+		}
+		for _, h := range hosts {
+			fm.Spec.Upstreams = append(fm.Spec.Upstreams, forkv1beta1.Upstream{Host: h})
+		}
+		return fm
+	}
+	genForkManagerWithTLS := func(gateway forkv1beta1.PreviewGateway, secretName string) runtime.Object {
+		fm := genForkManager("fork-identifier", "sandbox.example.com").(*forkv1beta1.ForkManager)
+		fm.Spec.PreviewGateway = gateway
+		fm.Spec.Upstreams[0].TLS = &forkv1beta1.UpstreamTLS{SecretName: secretName}
+		return fm
+	}
+	genVSConfig := func(headerName, headerValue string) runtime.Object {
+		return &forkv1beta1.VSConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "some-service-name-some-identifier", Namespace: "some-namespace"},
+			Spec: forkv1beta1.VSConfigSpec{
+				Host:        "some-service-name",
+				Service:     "some-service-name-some-identifier",
+				HeaderName:  headerName,
+				HeaderValue: headerValue,
+			},
+		}
+	}
+
+	testcases := []struct {
+		name      string
+		validator webhook.CustomValidator
+		obj       runtime.Object
+		wantErr   bool
+	}{
+		{
+			name:      "valid fork",
+			validator: forkValidator,
+			obj:       genFork(func(*forkv1beta1.Fork) {}),
+		},
+		{
+			name:      "fork with scoped services",
+			validator: forkValidator,
+			obj: genFork(func(frk *forkv1beta1.Fork) {
+				frk.Spec.Services.Scopes = []forkv1beta1.ServiceScope{
+					{Service: "search", RouteScope: forkv1beta1.RouteScope{URIPrefix: "/api/v2/search", Methods: []string{"GET"}}},
+				}
+			}),
+		},
+		{
+			name:      "fork with a scope having both uri prefix and regex",
+			validator: forkValidator,
+			obj: genFork(func(frk *forkv1beta1.Fork) {
+				frk.Spec.Services.Scopes = []forkv1beta1.ServiceScope{
+					{Service: "search", RouteScope: forkv1beta1.RouteScope{URIPrefix: "/api/v2/search", URIRegex: "^/api/v2/.*"}},
+				}
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork with mirror percentage out of range",
+			validator: forkValidator,
+			obj:       genFork(func(f *forkv1beta1.Fork) { f.Spec.Mirror = &forkv1beta1.MirrorPolicy{Percentage: 0} }),
+			wantErr:   true,
+		},
+		{
+			name:      "fork with canary steps",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Spec.Canary = &forkv1beta1.CanaryPolicy{Weight: 5, Steps: []forkv1beta1.CanaryStep{
+					{After: metav1.Duration{Duration: time.Hour}, Weight: 20},
+					{After: metav1.Duration{Duration: 2 * time.Hour}, Weight: 50},
+				}}
+			}),
+		},
+		{
+			name:      "fork with canary steps out of order",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Spec.Canary = &forkv1beta1.CanaryPolicy{Weight: 5, Steps: []forkv1beta1.CanaryStep{
+					{After: metav1.Duration{Duration: 2 * time.Hour}, Weight: 50},
+					{After: metav1.Duration{Duration: time.Hour}, Weight: 20},
+				}}
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork with envoy command operators in header values",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Spec.GatewayOptions = &forkv1beta1.GatewayOptions{AddRequestHeaders: map[string]string{"x-client": "%DOWNSTREAM_REMOTE_ADDRESS%"}}
+			}),
+		},
+		{
+			name:      "fork with header name which is not a token",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Spec.GatewayOptions = &forkv1beta1.GatewayOptions{AddRequestHeaders: map[string]string{"x-some-header \"a\";": "some-value"}}
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork with header value unsafe for the ingress gateway",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Spec.Manager = "ambassador/ingress"
+				f.Spec.GatewayOptions = &forkv1beta1.GatewayOptions{AddResponseHeaders: map[string]string{"x-some-header": "$host\"; return 200;"}}
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork with malformed manager",
+			validator: forkValidator,
+			obj:       genFork(func(f *forkv1beta1.Fork) { f.Spec.Manager = "default" }),
+			wantErr:   true,
+		},
+		{
+			name:      "fork with missing manager",
+			validator: forkValidator,
+			obj:       genFork(func(f *forkv1beta1.Fork) { f.Spec.Manager = "ambassador/missing" }),
+			wantErr:   true,
+		},
+		{
+			name:      "fork with identifier which is not a DNS label",
+			validator: forkValidator,
+			obj:       genFork(func(f *forkv1beta1.Fork) { f.Spec.Identifier = "Some.Identifier" }),
+			wantErr:   true,
+		},
+		{
+			name:      "fork with past deadline",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				deadline := metav1.NewTime(now.Add(-time.Minute))
+				f.Spec.Deadline = &deadline
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork without selectors",
+			validator: forkValidator,
+			obj:       genFork(func(f *forkv1beta1.Fork) { f.Spec.Services = nil }),
+			wantErr:   true,
+		},
+		{
+			name:      "fork within the policy",
+			validator: forkValidator,
+			obj:       genFork(func(f *forkv1beta1.Fork) { f.Spec.Manager = "ambassador/limited" }),
+		},
+		{
+			name:      "fork in a namespace not allowed",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Namespace = "another-namespace"
+				f.Spec.Manager = "ambassador/limited"
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork with deadline beyond max lifetime",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				deadline := metav1.NewTime(now.Add(2 * time.Hour))
+				f.Spec.Manager = "ambassador/limited"
+				f.Spec.Deadline = &deadline
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork with too many replicas",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				replicas := int32(3)
+				f.Spec.Manager = "ambassador/limited"
+				f.Spec.Deployments = &forkv1beta1.ForkDeployment{Selector: &metav1.LabelSelector{}, Replicas: &replicas}
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork exceeding forks per identifier",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Spec.Manager = "ambassador/limited"
+				f.Spec.Identifier = "existing-identifier"
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork with identifier colliding under prefix match",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Spec.Manager = "ambassador/prefix"
+			}),
+			wantErr: true,
+		},
+		{
+			name:      "fork with identifier not colliding under prefix match",
+			validator: forkValidator,
+			obj: genFork(func(f *forkv1beta1.Fork) {
+				f.Spec.Manager = "ambassador/prefix"
+				f.Spec.Identifier = "another-identifier"
+			}),
+		},
+		{
+			name:      "valid forkmanager",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj:       genForkManager("fork-identifier", "sandbox.example.com", "api.example.com"),
+		},
+		{
+			name:      "forkmanager with empty headerKey",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj:       genForkManager("", "sandbox.example.com"),
+			wantErr:   true,
+		},
+		{
+			name:      "forkmanager with duplicate upstream hosts",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj:       genForkManager("fork-identifier", "sandbox.example.com", "sandbox.example.com"),
+			wantErr:   true,
+		},
+		{
+			name:      "forkmanager with tls",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj:       genForkManagerWithTLS(forkv1beta1.PreviewGatewayEmissaryV3alpha1, "wildcard-tls"),
+		},
+		{
+			name:      "forkmanager with tls not supported by the gateway",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj:       genForkManagerWithTLS(forkv1beta1.PreviewGatewayEmissaryV2, "wildcard-tls"),
+			wantErr:   true,
+		},
+		{
+			name:      "forkmanager with tls without secretName",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj:       genForkManagerWithTLS(forkv1beta1.PreviewGatewayEmissaryV3alpha1, ""),
+			wantErr:   true,
+		},
+		{
+			name:      "forkmanager with hostTemplate without identifier",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj: func() runtime.Object {
+				fm := genForkManager("fork-identifier", "sandbox.example.com").(*forkv1beta1.ForkManager)
+				fm.Spec.Upstreams[0].HostTemplate = "sandbox.{host}"
+				return fm
+			}(),
+			wantErr: true,
+		},
+		{
+			name:      "forkmanager with gateway api without parentRefs",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj: func() runtime.Object {
+				fm := genForkManager("fork-identifier", "sandbox.example.com").(*forkv1beta1.ForkManager)
+				fm.Spec.PreviewGateway = forkv1beta1.PreviewGatewayGatewayAPI
+				return fm
+			}(),
+			wantErr: true,
+		},
+		{
+			name:      "forkmanager with routing prefix without leading slash",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj: func() runtime.Object {
+				fm := genForkManager("fork-identifier", "sandbox.example.com").(*forkv1beta1.ForkManager)
+				fm.Spec.Upstreams[0].Routing = &forkv1beta1.RoutingOptions{Prefix: "api/"}
+				return fm
+			}(),
+			wantErr: true,
+		},
+		{
+			name:      "forkmanager with headerKey which is not a token",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj:       genForkManager("fork identifier", "sandbox.example.com"),
+			wantErr:   true,
+		},
+		{
+			name:      "forkmanager with routing header value unsafe for the ingress gateway",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj: func() runtime.Object {
+				fm := genForkManager("fork-identifier", "sandbox.example.com").(*forkv1beta1.ForkManager)
+				fm.Spec.PreviewGateway = forkv1beta1.PreviewGatewayIngress
+				fm.Spec.Upstreams[0].Routing = &forkv1beta1.RoutingOptions{AddRequestHeaders: map[string]string{"x-some-header": "a\nmore_set_headers"}}
+				return fm
+			}(),
+			wantErr: true,
+		},
+		{
+			name:      "forkmanager with cookie identifier match with name",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj: func() runtime.Object {
+				fm := genForkManager("fork-identifier", "sandbox.example.com").(*forkv1beta1.ForkManager)
+				fm.Spec.IdentifierMatch = &forkv1beta1.IdentifierMatch{Type: forkv1beta1.MatchTypeCookie, Name: "fork"}
+				return fm
+			}(),
+		},
+		{
+			name:      "forkmanager with exact identifier match with name",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj: func() runtime.Object {
+				fm := genForkManager("fork-identifier", "sandbox.example.com").(*forkv1beta1.ForkManager)
+				fm.Spec.IdentifierMatch = &forkv1beta1.IdentifierMatch{Type: forkv1beta1.MatchTypeExact, Name: "fork"}
+				return fm
+			}(),
+			wantErr: true,
+		},
+		{
+			name:      "valid vsconfig",
+			validator: &forkv1beta1.VSConfigValidator{},
+			obj:       genVSConfig("fork-identifier", "some-identifier"),
+		},
+		{
+			name:      "vsconfig with empty headerName",
+			validator: &forkv1beta1.VSConfigValidator{},
+			obj:       genVSConfig("", "some-identifier"),
+			wantErr:   true,
+		},
+		{
+			name:      "vsconfig with empty headerValue",
+			validator: &forkv1beta1.VSConfigValidator{},
+			obj:       genVSConfig("fork-identifier", ""),
+			wantErr:   true,
+		},
+		{
+			name:      "vsconfig with regex match without pattern",
+			validator: &forkv1beta1.VSConfigValidator{},
+			obj: func() runtime.Object {
+				vsc := genVSConfig("fork-identifier", "some-identifier").(*forkv1beta1.VSConfig)
+				vsc.Spec.MatchType = forkv1beta1.MatchTypeRegex
+				return vsc
+			}(),
+			wantErr: true,
+		},
+		{
+			name:      "forkmanager with regex identifier match",
+			validator: &forkv1beta1.ForkManagerValidator{},
+			obj: func() runtime.Object {
+				fm := genForkManager("fork-identifier", "sandbox.example.com").(*forkv1beta1.ForkManager)
+				fm.Spec.IdentifierMatch = &forkv1beta1.IdentifierMatch{Type: forkv1beta1.MatchTypeRegex, Pattern: "^(.+,)?{identifier}(,.+)?$"}
+				return fm
+			}(),
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.validator.ValidateCreate(context.Background(), tc.obj)
+			if tc.wantErr && err == nil {
+				t.Fatal("expected an error but got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestForkValidateUpdate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := forkv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&forkv1beta1.ForkManager{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "ambassador"},
+	}).Build()
+	v := &forkv1beta1.ForkValidator{Client: fakeClient, Clock: clock.NewFakePassiveClock(now)}
+
+	past := metav1.NewTime(now.Add(-time.Minute))
+	old := &forkv1beta1.Fork{
+		Spec: forkv1beta1.ForkSpec{
+			Manager:    "ambassador/default",
+			Identifier: "some-identifier",
+			Deadline:   &past,
+			Services:   &forkv1beta1.ForkService{Selector: &metav1.LabelSelector{}},
+		},
+	}
+
+	// an expired fork can be updated as long as its deadline is untouched
+	updated := old.DeepCopy()
+	updated.Labels = map[string]string{"some": "label"}
+	if err := v.ValidateUpdate(context.Background(), old, updated); err != nil {
+		t.Fatal(err)
+	}
+
+	// the controller can annotate a fork whose manager is deleted after the fork is admitted
+	orphan := old.DeepCopy()
+	orphan.Spec.Manager = "ambassador/missing"
+	annotated := orphan.DeepCopy()
+	annotated.Annotations = map[string]string{"fork.k8s.wantedly.com/expiry-warning": past.UTC().Format(time.RFC3339)}
+	if err := v.ValidateUpdate(context.Background(), orphan, annotated); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := old.DeepCopy()
+	earlier := metav1.NewTime(now.Add(-time.Hour))
+	moved.Spec.Deadline = &earlier
+	if err := v.ValidateUpdate(context.Background(), old, moved); err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+}
+
+func TestVSConfigValidateUpdate(t *testing.T) {
+	v := &forkv1beta1.VSConfigValidator{}
+
+	// a VSConfig admitted before the current validation, whose pattern is missing
+	old := &forkv1beta1.VSConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-service-name-some-identifier", Namespace: "some-namespace"},
+		Spec: forkv1beta1.VSConfigSpec{
+			Host:        "some-service-name",
+			Service:     "some-service-name-some-identifier",
+			HeaderName:  "fork-identifier",
+			HeaderValue: "some-identifier",
+			MatchType:   forkv1beta1.MatchTypeRegex,
+		},
+	}
+
+	// the controller can add finalizers and labels to it
+	updated := old.DeepCopy()
+	updated.Finalizers = []string{"fork.k8s.wantedly.com/finalizer"}
+	updated.Labels = map[string]string{"some": "label"}
+	if err := v.ValidateUpdate(context.Background(), old, updated); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := old.DeepCopy()
+	changed.Spec.HeaderValue = "another-identifier"
+	if err := v.ValidateUpdate(context.Background(), old, changed); err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+}
+
+func TestForkDefault(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := forkv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&forkv1beta1.ForkManager{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "ambassador"},
+		Spec:       forkv1beta1.ForkManagerSpec{MaxLifetime: &metav1.Duration{Duration: 2 * time.Hour}},
+	}).Build()
+	d := &forkv1beta1.ForkDefaulter{Client: fakeClient, Clock: clock.NewFakePassiveClock(now)}
+
+	testcases := []struct {
+		name         string
+		manager      string
+		wantDeadline time.Time
+	}{
+		{
+			name:         "lifetime of the manager",
+			manager:      "ambassador/default",
+			wantDeadline: now.Add(2 * time.Hour),
+		},
+		{
+			name:         "default lifetime when the manager is missing",
+			manager:      "ambassador/missing",
+			wantDeadline: now.Add(forkv1beta1.DefaultMaxLifetime),
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			frk := &forkv1beta1.Fork{
+				Spec: forkv1beta1.ForkSpec{
+					Manager:    tc.manager,
+					Identifier: "some-identifier",
+					Deployments: &forkv1beta1.ForkDeployment{
+						Template: &forkv1beta1.PodTemplateSpec{
+							Spec: forkv1beta1.PodSpec{
+								Containers: []corev1.Container{
+									{Name: "app"},
+									{Name: "sidecar", Env: []corev1.EnvVar{{Name: forkv1beta1.IdentifierEnvName, Value: "stale"}}},
+								},
+							},
+						},
+					},
+				},
+			}
+			if err := d.Default(context.Background(), frk); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := frk.Labels[forkv1beta1.IdentifierLabelKey]; got != "some-identifier" {
+				t.Errorf("identifier label = %q", got)
+			}
+			if frk.Spec.Deadline == nil || !frk.Spec.Deadline.Time.Equal(tc.wantDeadline) {
+				t.Errorf("deadline = %v, want %v", frk.Spec.Deadline, tc.wantDeadline)
+			}
+			if r := frk.Spec.Deployments.Replicas; r == nil || *r != 1 {
+				t.Errorf("replicas = %v", r)
+			}
+			for _, c := range frk.Spec.Deployments.Template.Spec.Containers {
+				want := []corev1.EnvVar{{Name: forkv1beta1.IdentifierEnvName, Value: "some-identifier"}}
+				if !reflect.DeepEqual(c.Env, want) {
+					t.Errorf("env of %s = %v", c.Name, c.Env)
+				}
+			}
+		})
+	}
+}
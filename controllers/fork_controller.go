@@ -18,15 +18,23 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"github.com/pkg/errors"
+	ddv1beta1 "github.com/wantedly/deployment-duplicator/api/v1beta1"
 	"github.com/wantedly/kubefork-controller/domain/updater"
 	"github.com/wantedly/kubefork-controller/pkg/middleware"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 	"strings"
 	"time"
@@ -42,18 +50,24 @@ import (
 // ForkReconciler reconciles a Fork object
 type ForkReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Clock  clock.WithTickerAndDelayedExecution
+	Scheme   *runtime.Scheme
+	Clock    clock.WithTickerAndDelayedExecution
+	Recorder record.EventRecorder
+
+	// ExpiryWarning is how long before the deadline a fork is warned of its expiry, disabled when zero
+	ExpiryWarning time.Duration
 }
 
 // Input resources
-// +kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=forks;forkmanagers,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=forks;forkmanagers,verbs=get;list;watch;update;patch;delete
+// +kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=forks/status;forkmanagers/status,verbs=get;update;patch
 //
 // Output resources
 // +kubebuilder:rbac:groups=getambassador.io,resources=mappings,verbs=get;list;watch;create;update;patch;delete;deletecollection;
 // +kubebuilder:rbac:groups=duplication.k8s.wantedly.com,resources=deploymentcopies,verbs=get;list;watch;create;update;patch;delete;deletecollection;
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;
-// +kubebuilder:rbac:groups="",resources=services,verbs=create;update;delete;
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;delete;
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -67,7 +81,7 @@ type ForkReconciler struct {
 func (r *ForkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
 
-	up := updater.NewMappingUpdater(r.Client, log.Log, r.Scheme)
+	up := updater.NewMappingUpdater(r.Client, log.Log, r.Scheme, r.Clock)
 
 	frk := &forkv1beta1.Fork{}
 	forkSlug := types.NamespacedName{Namespace: req.Namespace, Name: req.Name}
@@ -80,34 +94,179 @@ func (r *ForkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		}
 	}
 
-	now := v1.NewTime(r.Clock.Now())
-	// Remove fork resources that exceed the deadline
-	if frk.Spec.Deadline != nil && frk.Spec.Deadline.Before(&now) {
+	// Remove fork resources that reach the deadline
+	untilDeadline := time.Duration(0)
+	if frk.Spec.Deadline != nil {
+		untilDeadline = frk.Spec.Deadline.Sub(r.Clock.Now())
+	}
+	if frk.Spec.Deadline != nil && untilDeadline <= 0 {
+		frk.Status.Phase = forkv1beta1.ForkPhaseExpiring
+		if err := r.Status().Update(ctx, frk); err != nil {
+			return ctrl.Result{}, errors.WithStack(err)
+		}
 		return ctrl.Result{}, errors.WithStack(r.Delete(ctx, frk))
 	}
 
-	{ // update mapping
+	warnAfter, err := r.warnExpiry(ctx, frk)
+	if err != nil {
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	res, reconcileErr := r.reconcileResources(ctx, frk)
+
+	// VSConfigs are generated with the weight at the time, so the fork is reconciled again at the next step
+	canaryWeight, untilNextStep := frk.Spec.CanaryWeightAt(frk.CreationTimestamp.Time, r.Clock.Now())
+	frk.Status.CanaryWeight = canaryWeight
+	frk.Status.ObservedGeneration = frk.Generation
+	frk.Status.Phase = forkPhase(frk.Status)
+	if err := r.Status().Update(ctx, frk); err != nil {
+		if reconcileErr != nil {
+			return ctrl.Result{}, errors.WithStack(reconcileErr)
+		}
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+	if reconcileErr != nil {
+		return ctrl.Result{}, errors.WithStack(reconcileErr)
+	}
+
+	var pendingAfter time.Duration
+	if frk.Status.Phase == forkv1beta1.ForkPhasePending {
+		// status updates of copied deployments are not watched, so check them again later
+		pendingAfter = pendingRequeueInterval
+	}
+	// the fork is reconciled again exactly at its deadline to be deleted
+	res.RequeueAfter = earliest(res.RequeueAfter, pendingAfter, warnAfter, untilNextStep, untilDeadline)
+
+	return res, nil
+}
+
+// earliest returns the shortest positive duration, or zero when there is none
+func earliest(durations ...time.Duration) time.Duration {
+	var res time.Duration
+	for _, d := range durations {
+		if d > 0 && (res == 0 || d < res) {
+			res = d
+		}
+	}
+	return res
+}
+
+// warnExpiry annotates the fork and emits an event once it gets within ExpiryWarning of its deadline
+// It returns how long to wait until the warning when it is not due yet
+func (r *ForkReconciler) warnExpiry(ctx context.Context, frk *forkv1beta1.Fork) (time.Duration, error) {
+	if r.ExpiryWarning == 0 || frk.Spec.Deadline == nil {
+		return 0, nil
+	}
+
+	deadline := frk.Spec.Deadline.UTC().Format(time.RFC3339)
+	// the annotation holds the deadline warned of, so an extended fork is warned again
+	if frk.Annotations[annotationKeyExpiryWarning] == deadline {
+		return 0, nil
+	}
+
+	if wait := frk.Spec.Deadline.Add(-r.ExpiryWarning).Sub(r.Clock.Now()); wait > 0 {
+		return wait, nil
+	}
+
+	if frk.Annotations == nil {
+		frk.Annotations = map[string]string{}
+	}
+	frk.Annotations[annotationKeyExpiryWarning] = deadline
+	if err := r.Update(ctx, frk); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(frk, corev1.EventTypeWarning, "ExpiringSoon",
+			"Fork will be deleted at %s, run `kubeforkctl extend %s` to keep it", deadline, frk.Spec.Identifier)
+	}
+
+	return 0, nil
+}
+
+// reconcileResources updates resources generated for the fork and records the result on its conditions
+func (r *ForkReconciler) reconcileResources(ctx context.Context, frk *forkv1beta1.Fork) (ctrl.Result, error) {
+	up := updater.NewMappingUpdater(r.Client, log.Log, r.Scheme, r.Clock, driftRecorder(r.Recorder, r.Scheme))
+	forkSlug := types.NamespacedName{Namespace: frk.Namespace, Name: frk.Name}
+
+	var managerSlug types.NamespacedName
+	{ // resolve manager
 		slugParts := strings.Split(frk.Spec.Manager, "/")
 		if len(slugParts) != 2 {
+			r.setCondition(frk, forkv1beta1.ForkConditionManagerResolved, v1.ConditionFalse, "MalformedManager", "field `manager` must be in the form of <namespace>/<name>")
 			return ctrl.Result{}, errors.New("malformed field `manager`")
 		}
 
-		nn := types.NamespacedName{Namespace: slugParts[0], Name: slugParts[1]}
-		if err := up.Update(ctx, nn); err != nil {
+		managerSlug = types.NamespacedName{Namespace: slugParts[0], Name: slugParts[1]}
+		if err := r.Get(ctx, managerSlug, &forkv1beta1.ForkManager{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				r.setCondition(frk, forkv1beta1.ForkConditionManagerResolved, v1.ConditionFalse, "ManagerNotFound", fmt.Sprintf("ForkManager %s is not found", managerSlug))
+			}
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+		r.setCondition(frk, forkv1beta1.ForkConditionManagerResolved, v1.ConditionTrue, "Resolved", "")
+	}
+
+	{ // check policy of the manager, updaters below don't generate resources for a fork violating it
+		violations, err := updater.PolicyViolations(ctx, r.Client, frk, r.Clock.Now())
+		if err != nil {
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+		if len(violations) != 0 {
+			r.setCondition(frk, forkv1beta1.ForkConditionPolicyCompliant, v1.ConditionFalse, "PolicyViolated", violations.ToAggregate().Error())
+		} else {
+			r.setCondition(frk, forkv1beta1.ForkConditionPolicyCompliant, v1.ConditionTrue, "Compliant", "")
+		}
+	}
+
+	{ // update mapping
+		if err := up.Update(ctx, managerSlug); err != nil {
+			r.setCondition(frk, forkv1beta1.ForkConditionRoutingConfigured, v1.ConditionFalse, "MappingUpdateFailed", err.Error())
 			return ctrl.Result{}, errors.WithStack(err)
 		}
 	}
 
 	{ // update deployment and service
-		mup := updater.NewMicroserviceUpdater(r.Client, log.Log, r.Scheme)
+		mup := updater.NewMicroserviceUpdater(r.Client, log.Log, r.Scheme, r.Clock, driftRecorder(r.Recorder, r.Scheme))
 		if err := mup.Update(ctx, forkSlug); err != nil {
+			r.setCondition(frk, forkv1beta1.ForkConditionServicesForked, v1.ConditionFalse, "UpdateFailed", err.Error())
 			return ctrl.Result{}, errors.WithStack(err)
 		}
 	}
 
+	inv, err := r.collectInventory(ctx, frk, managerSlug)
+	if err != nil {
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+	frk.Status.Resources = inv.references()
+	frk.Status.Mirroring = inv.mirroredServices()
+
+	r.setCondition(frk, forkv1beta1.ForkConditionServicesForked, v1.ConditionTrue, "Forked",
+		fmt.Sprintf("%d Services and %d DeploymentCopies are generated", len(inv.services), len(inv.deploymentCopies)))
+	r.setCondition(frk, forkv1beta1.ForkConditionRoutingConfigured, v1.ConditionTrue, "Configured",
+		fmt.Sprintf("%d VSConfigs and %d Mappings are generated", len(inv.vsConfigs), len(inv.gatewayResources)))
+
+	if notReady := inv.unavailableDeployments(); len(notReady) != 0 {
+		r.setCondition(frk, forkv1beta1.ForkConditionDeploymentCopiesReady, v1.ConditionFalse, "DeploymentsUnavailable",
+			fmt.Sprintf("Deployments not available yet: %s", strings.Join(notReady, ", ")))
+	} else {
+		r.setCondition(frk, forkv1beta1.ForkConditionDeploymentCopiesReady, v1.ConditionTrue, "Available", "")
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// setCondition sets a condition with the time of the injected clock
+func (r *ForkReconciler) setCondition(frk *forkv1beta1.Fork, conditionType string, status v1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&frk.Status.Conditions, v1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: frk.Generation,
+		LastTransitionTime: v1.NewTime(r.Clock.Now()),
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
 func (r *ForkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	watcher, err := r.SetupForkWatcher(mgr)
 	if err != nil {
@@ -116,10 +275,24 @@ func (r *ForkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&forkv1beta1.Fork{}).
+		// restore generated resources deleted or edited by others
+		Owns(&corev1.Service{}).
+		Owns(&ddv1beta1.DeploymentCopy{}).
+		Owns(&forkv1beta1.VSConfig{}).
 		Watches(watcher, &handler.EnqueueRequestForObject{}).
+		// keep forks in sync with their target resources and managers
+		Watches(&source.Kind{Type: &corev1.Service{}}, handler.EnqueueRequestsFromMapFunc(r.forksSelectingService)).
+		// status updates of deployments, which are frequent, are ignored
+		Watches(&source.Kind{Type: &appsv1.Deployment{}}, handler.EnqueueRequestsFromMapFunc(r.forksSelectingDeployment),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
+		// status updates of managers change nothing in forks
+		Watches(&source.Kind{Type: &forkv1beta1.ForkManager{}}, handler.EnqueueRequestsFromMapFunc(r.forksOfManager),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(middleware.Honeybadger(r))
 }
 
+// SetupForkWatcher adds a watcher which periodically enqueues expired forks
+// Forks are requeued at their deadlines, so this is only a safety net for missed requeues such as on restarts
 func (r *ForkReconciler) SetupForkWatcher(mgr ctrl.Manager) (*source.Channel, error) {
 	if r.Clock == nil {
 		r.Clock = clock.RealClock{}
@@ -127,9 +300,10 @@ func (r *ForkReconciler) SetupForkWatcher(mgr ctrl.Manager) (*source.Channel, er
 	ch := make(chan event.GenericEvent)
 	watcher := forkWatcher{
 		Client:   r.Client,
+		Clock:    r.Clock,
 		channel:  ch,
 		Log:      log.Log,
-		TickTime: 1 * time.Minute,
+		TickTime: forkWatcherInterval,
 	}
 	if err := mgr.Add(watcher); err != nil {
 		return nil, errors.Wrap(err, "failed to add fork watcher")
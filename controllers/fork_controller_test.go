@@ -9,10 +9,12 @@ import (
 	ddv1beta1 "github.com/wantedly/deployment-duplicator/api/v1beta1"
 	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	clock "k8s.io/utils/clock/testing"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -59,6 +61,8 @@ func TestForkReconciler(t *testing.T) {
 	pastDate, _ := time.Parse(time.RFC3339, "2009-11-10T22:50:00Z")
 	// futureDate indicates that the deadline is 10 minutes from now
 	futureDate, _ := time.Parse(time.RFC3339, "2009-11-10T23:10:00Z")
+	// soonDate indicates that the deadline is within expiryWarning from now
+	soonDate, _ := time.Parse(time.RFC3339, "2009-11-10T23:03:00Z")
 	testcases := []testcase{
 		{
 			name:        "one fork without deadline",
@@ -82,6 +86,49 @@ func TestForkReconciler(t *testing.T) {
 				ut.GenForkManagerWithHostRewrite(),
 			},
 		},
+		{
+			name:        "one fork with selector",
+			explanation: "services and deployments matching the selector are forked and the fork is pending until copied deployments become available",
+			initialState: []client.Object{
+				ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(futureDate)), ut.AddForkSelector(map[string]string{"app": "some-app"}),
+					ut.AddForkDeploymentAnnotation("some-annotation-added-to-copied-deployment", "true")),
+				ut.GenForkManager(),
+			},
+		},
+		{
+			name:        "mirroring fork",
+			explanation: "vsconfigs of the forked services mirror requests without the identifier",
+			initialState: []client.Object{
+				ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(futureDate)), ut.AddForkSelector(map[string]string{"app": "some-app"}), ut.SetForkMirror(10)),
+				ut.GenForkManager(),
+			},
+		},
+		{
+			name:        "canary fork",
+			explanation: "vsconfigs of the forked services send the weight of the current step of requests without the identifier",
+			initialState: []client.Object{
+				ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(futureDate)), ut.AddForkSelector(map[string]string{"app": "some-app"}),
+					ut.SetForkCanary(metav1.NewTime(pastDate), 5, forkv1beta1.CanaryStep{After: metav1.Duration{Duration: 5 * time.Minute}, Weight: 20})),
+				ut.GenForkManager(),
+			},
+		},
+		{
+			name:        "fork violating policy",
+			explanation: "when a fork is not allowed by the policy of the manager, no resources are generated for it",
+			initialState: []client.Object{
+				ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(futureDate)), ut.AddForkSelector(map[string]string{"app": "some-app"}),
+					ut.AddForkDeploymentAnnotation("some-annotation-added-to-copied-deployment", "true")),
+				ut.SetForkManagerAllowedNamespaces(ut.GenForkManager(), "another-namespace"),
+			},
+		},
+		{
+			name:        "fork expiring soon",
+			explanation: "when a deadline is within the expiry warning, the fork is annotated with the deadline",
+			initialState: []client.Object{
+				ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(soonDate))),
+				ut.GenForkManager(),
+			},
+		},
 		{
 			name:        "old fork",
 			explanation: "when a deadline is exceed, Updater must delete Fork resource",
@@ -101,6 +148,19 @@ func TestForkReconciler(t *testing.T) {
 				ut.GenForkManager(),
 			},
 		},
+		{
+			name:        "mapping of a manager in another namespace",
+			explanation: "mappings of a manager with the same name in another namespace must be kept",
+			initialState: []client.Object{
+				ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(futureDate))),
+				func() client.Object {
+					mapping := ut.GenMapping("another-identifier", "another-identifier.example.com")
+					mapping.Namespace = "another-namespace"
+					return mapping
+				}(),
+				ut.GenForkManager(),
+			},
+		},
 		{
 			name:        "additional headers",
 			explanation: "additional headers should be reflected to mappings",
@@ -188,7 +248,13 @@ func TestForkReconciler(t *testing.T) {
 					now, _ := time.Parse(time.RFC3339, "2009-11-10T23:00:00Z")
 					fakeClock := clock.NewFakeClock(now)
 
-					rec := controllers.ForkReconciler{Client: fakeClient, Scheme: scheme, Clock: fakeClock}
+					rec := controllers.ForkReconciler{
+						Client:        fakeClient,
+						Scheme:        scheme,
+						Clock:         fakeClock,
+						Recorder:      record.NewFakeRecorder(10),
+						ExpiryWarning: 5 * time.Minute,
+					}
 
 					ctx := context.Background()
 
@@ -205,6 +271,7 @@ func TestForkReconciler(t *testing.T) {
 							&corev1.ServiceList{},
 							&forkv1beta1.VSConfigList{},
 							&forkv1beta1.ForkList{},
+							&forkv1beta1.ForkManagerList{},
 						}
 
 						for _, ls := range lists {
@@ -224,3 +291,237 @@ func TestForkReconciler(t *testing.T) {
 		})
 	}
 }
+
+func TestForkReconcilerRequeueAtDeadline(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, forkv1beta1.AddToScheme, ambassador.AddToScheme, ddv1beta1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2009-11-10T23:00:00Z")
+	deadline := now.Add(10 * time.Minute)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(deadline))),
+		ut.GenForkManager(),
+	).Build()
+	fakeClock := clock.NewFakeClock(now)
+
+	rec := controllers.ForkReconciler{
+		Client: fakeClient,
+		Scheme: scheme,
+		Clock:  fakeClock,
+	}
+
+	ctx := context.Background()
+	nn := types.NamespacedName{Name: "some-identifier", Namespace: "some-namespace"}
+	req := ctrl.Request{NamespacedName: nn}
+
+	res, err := rec.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if res.RequeueAfter != 10*time.Minute {
+		t.Fatalf("RequeueAfter = %s, want 10m", res.RequeueAfter)
+	}
+
+	fakeClock.Step(res.RequeueAfter)
+	if _, err := rec.Reconcile(ctx, req); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := fakeClient.Get(ctx, nn, &forkv1beta1.Fork{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("fork must be deleted at the deadline, got %v", err)
+	}
+}
+
+func TestForkReconcilerRequeueAtCanaryStep(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, forkv1beta1.AddToScheme, ambassador.AddToScheme, ddv1beta1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2009-11-10T23:00:00Z")
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(now.Add(time.Hour))),
+			ut.SetForkCanary(metav1.NewTime(now), 5, forkv1beta1.CanaryStep{After: metav1.Duration{Duration: 10 * time.Minute}, Weight: 20})),
+		ut.GenForkManager(),
+	).Build()
+	fakeClock := clock.NewFakeClock(now)
+
+	rec := controllers.ForkReconciler{
+		Client: fakeClient,
+		Scheme: scheme,
+		Clock:  fakeClock,
+	}
+
+	ctx := context.Background()
+	nn := types.NamespacedName{Name: "some-identifier", Namespace: "some-namespace"}
+	req := ctrl.Request{NamespacedName: nn}
+
+	for _, want := range []struct {
+		weight       int32
+		requeueAfter time.Duration
+	}{
+		{weight: 5, requeueAfter: 10 * time.Minute},
+		{weight: 20, requeueAfter: 50 * time.Minute},
+	} {
+		res, err := rec.Reconcile(ctx, req)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		frk := &forkv1beta1.Fork{}
+		if err := fakeClient.Get(ctx, nn, frk); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if frk.Status.CanaryWeight != want.weight || res.RequeueAfter != want.requeueAfter {
+			t.Fatalf("(CanaryWeight, RequeueAfter) = (%d, %s), want (%d, %s)", frk.Status.CanaryWeight, res.RequeueAfter, want.weight, want.requeueAfter)
+		}
+		fakeClock.Step(res.RequeueAfter)
+	}
+}
+
+func TestForkReconcilerRepairsDrift(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, forkv1beta1.AddToScheme, ambassador.AddToScheme, ddv1beta1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2009-11-10T23:00:00Z")
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(now.Add(time.Hour))), ut.AddForkSelector(map[string]string{"app": "some-app"})),
+		ut.GenForkManager(),
+		ut.GenDeployment("some-deployment", map[string]string{"app": "some-app", "role": "web"}),
+		ut.GenService("service-for-some-deployment", ut.AddSVCLabel("app", "some-app")),
+	).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	rec := controllers.ForkReconciler{
+		Client:   fakeClient,
+		Scheme:   scheme,
+		Clock:    clock.NewFakeClock(now),
+		Recorder: recorder,
+	}
+
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "some-identifier", Namespace: "some-namespace"}}
+	for i := 0; i < 2; i++ {
+		if _, err := rec.Reconcile(ctx, req); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	if len(recorder.Events) != 0 {
+		t.Fatalf("no drift is expected without changes, got %q", <-recorder.Events)
+	}
+
+	forkedServices := &corev1.ServiceList{}
+	if err := fakeClient.List(ctx, forkedServices, client.MatchingLabels{forkv1beta1.IdentifierLabelKey: "some-identifier"}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	vscs := &forkv1beta1.VSConfigList{}
+	if err := fakeClient.List(ctx, vscs); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(forkedServices.Items) != 1 || len(vscs.Items) != 1 {
+		t.Fatalf("one forked Service and VSConfig are expected, got %d and %d", len(forkedServices.Items), len(vscs.Items))
+	}
+
+	svc := forkedServices.Items[0]
+	if err := fakeClient.Delete(ctx, &svc); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	vsc := vscs.Items[0]
+	vsc.Spec.HeaderValue = "edited-by-hand"
+	if err := fakeClient.Update(ctx, &vsc); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if _, err := rec.Reconcile(ctx, req); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	want := []string{
+		"Warning DriftRepaired Service " + svc.Name + " was deleted and has been recreated",
+		"Warning DriftRepaired VSConfig " + vsc.Name + " differed from the desired state and has been restored",
+	}
+	for _, w := range want {
+		select {
+		case got := <-recorder.Events:
+			if got != w {
+				t.Errorf("event = %q, want %q", got, w)
+			}
+		default:
+			t.Errorf("event %q is not recorded", w)
+		}
+	}
+	if err := fakeClient.Get(ctx, client.ObjectKeyFromObject(&svc), &corev1.Service{}); err != nil {
+		t.Errorf("forked Service must be recreated: %v", err)
+	}
+}
+
+func TestForkReconcilerIgnoresDesiredChangesAsDrift(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, forkv1beta1.AddToScheme, ambassador.AddToScheme, ddv1beta1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2009-11-10T23:00:00Z")
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(now.Add(time.Hour))), ut.AddForkSelector(map[string]string{"app": "some-app"}),
+			ut.SetForkCanary(metav1.NewTime(now), 5, forkv1beta1.CanaryStep{After: metav1.Duration{Duration: 10 * time.Minute}, Weight: 20})),
+		ut.GenForkManager(),
+		ut.GenDeployment("some-deployment", map[string]string{"app": "some-app", "role": "web"}),
+		ut.GenService("service-for-some-deployment", ut.AddSVCLabel("app", "some-app")),
+	).Build()
+	fakeClock := clock.NewFakeClock(now)
+	recorder := record.NewFakeRecorder(10)
+
+	rec := controllers.ForkReconciler{
+		Client:   fakeClient,
+		Scheme:   scheme,
+		Clock:    fakeClock,
+		Recorder: recorder,
+	}
+
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "some-identifier", Namespace: "some-namespace"}}
+	if _, err := rec.Reconcile(ctx, req); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// the canary steps to the next weight
+	fakeClock.Step(10 * time.Minute)
+	if _, err := rec.Reconcile(ctx, req); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// the manager changes the header forks are routed by
+	fm := &forkv1beta1.ForkManager{}
+	if err := fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "ambassador"}, fm); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	fm.Spec.HeaderKey = "x-another-header"
+	if err := fakeClient.Update(ctx, fm); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err := rec.Reconcile(ctx, req); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	vscs := &forkv1beta1.VSConfigList{}
+	if err := fakeClient.List(ctx, vscs); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(vscs.Items) != 1 || vscs.Items[0].Spec.Weight != 20 || vscs.Items[0].Spec.HeaderName != "x-another-header" {
+		t.Fatalf("VSConfig must follow the desired state, got %+v", vscs.Items)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("no drift is expected for changes of the desired state, got %q", <-recorder.Events)
+	}
+}
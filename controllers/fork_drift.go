@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"fmt"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/pkg/refresh"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	util "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// driftRecorder returns an observer which emits an event on the owner when a generated resource is restored to the desired state
+// Changes are not counted as drift while the owner has a spec not reconciled yet
+// Updates for a new desired state, such as a canary step or a change of the manager, are not notified by refresh
+func driftRecorder(recorder record.EventRecorder, scheme *runtime.Scheme) refresh.Observer {
+	return func(owner, obj client.Object, result util.OperationResult) {
+		if recorder == nil || !observed(owner) {
+			return
+		}
+
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			log.Log.Error(err, "failed to get kind of drifted resource")
+			return
+		}
+
+		var message string
+		switch {
+		case result == util.OperationResultUpdated:
+			message = fmt.Sprintf("%s %s differed from the desired state and has been restored", gvk.Kind, obj.GetName())
+		case result == util.OperationResultCreated && generatedBefore(owner, gvk.Kind, obj.GetName()):
+			message = fmt.Sprintf("%s %s was deleted and has been recreated", gvk.Kind, obj.GetName())
+		default:
+			return
+		}
+		recorder.Event(owner, corev1.EventTypeWarning, "DriftRepaired", message)
+	}
+}
+
+// observed reports whether the current spec of the owner has been reconciled
+func observed(owner client.Object) bool {
+	switch o := owner.(type) {
+	case *forkv1beta1.Fork:
+		return o.Status.ObservedGeneration == o.Generation
+	case *forkv1beta1.ForkManager:
+		return o.Status.ObservedGeneration == o.Generation
+	}
+	return false
+}
+
+// generatedBefore reports whether the resource is listed in the status of the owner
+func generatedBefore(owner client.Object, kind, name string) bool {
+	switch o := owner.(type) {
+	case *forkv1beta1.Fork:
+		for _, res := range o.Status.Resources {
+			if res.Kind == kind && res.Name == name {
+				return true
+			}
+		}
+	case *forkv1beta1.ForkManager:
+		// Mappings lists the names of resources of any preview gateway but Hosts
+		for _, is := range o.Status.Identifiers {
+			for _, mp := range is.Mappings {
+				if kind != "Host" && mp == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
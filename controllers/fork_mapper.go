@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// forksSelectingService maps a Service to Forks in its namespace which select it
+// Both old and new objects are mapped on updates, so relabelled Services are unforked as well
+func (r *ForkReconciler) forksSelectingService(obj client.Object) []reconcile.Request {
+	// Services generated by forks are not targets
+	if _, ok := obj.GetLabels()[forkv1beta1.IdentifierLabelKey]; ok {
+		return nil
+	}
+	return r.forksInNamespace(obj, forkServiceSelectorField, func(f *forkv1beta1.Fork) bool {
+		return f.SelectsService(obj.GetLabels())
+	})
+}
+
+// forksSelectingDeployment maps a Deployment to Forks in its namespace which select it
+func (r *ForkReconciler) forksSelectingDeployment(obj client.Object) []reconcile.Request {
+	return r.forksInNamespace(obj, forkDeploymentSelectorField, func(f *forkv1beta1.Fork) bool {
+		return f.SelectsDeployment(obj.GetLabels())
+	})
+}
+
+// forksOfManager maps a ForkManager to Forks referring to it
+func (r *ForkReconciler) forksOfManager(obj client.Object) []reconcile.Request {
+	manager := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}.String()
+	forks := &forkv1beta1.ForkList{}
+	if err := r.List(context.Background(), forks, client.MatchingFields{forkv1beta1.ForkManagerField: manager}); err != nil {
+		log.Log.Error(err, "failed to list forks of manager", "manager", manager)
+		return nil
+	}
+	return forkRequests(forks.Items, func(*forkv1beta1.Fork) bool { return true })
+}
+
+// forksInNamespace looks up Forks in the namespace of the object by the selector index, and checks their selectors with the labels
+func (r *ForkReconciler) forksInNamespace(obj client.Object, selectorField string, selects func(*forkv1beta1.Fork) bool) []reconcile.Request {
+	var forks []forkv1beta1.Fork
+	for _, value := range labelIndexValues(obj.GetLabels()) {
+		list := &forkv1beta1.ForkList{}
+		if err := r.List(context.Background(), list, client.InNamespace(obj.GetNamespace()), client.MatchingFields{selectorField: value}); err != nil {
+			log.Log.Error(err, "failed to list forks", "namespace", obj.GetNamespace())
+			return nil
+		}
+		forks = append(forks, list.Items...)
+	}
+	return forkRequests(forks, selects)
+}
+
+// forkRequests returns requests of the selected forks, where forks listed more than once are requested once
+func forkRequests(forks []forkv1beta1.Fork, selects func(*forkv1beta1.Fork) bool) []reconcile.Request {
+	var reqs []reconcile.Request
+	seen := map[types.NamespacedName]bool{}
+	for i := range forks {
+		nn := types.NamespacedName{Namespace: forks[i].Namespace, Name: forks[i].Name}
+		if seen[nn] || !selects(&forks[i]) {
+			continue
+		}
+		seen[nn] = true
+		reqs = append(reqs, reconcile.Request{NamespacedName: nn})
+	}
+	return reqs
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	ddv1beta1 "github.com/wantedly/deployment-duplicator/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/domain/updater"
+)
+
+const (
+	// interval to check copied deployments again while a fork is pending, since their status updates are not watched
+	pendingRequeueInterval = 30 * time.Second
+	// interval of the safety net looking for expired forks
+	forkWatcherInterval = 10 * time.Minute
+
+	// annotated with the deadline once a fork is warned of its expiry
+	annotationKeyExpiryWarning = "fork.k8s.wantedly.com/expiry-warning"
+)
+
+// forkInventory is a set of resources generated for a fork
+type forkInventory struct {
+	services         []corev1.Service
+	deploymentCopies []ddv1beta1.DeploymentCopy
+	vsConfigs        []forkv1beta1.VSConfig
+	// resources of preview gateways, such as Mappings
+	gatewayResources []unstructured.Unstructured
+
+	// key: name of DeploymentCopy
+	// value: Deployment created by deployment-duplicator, nil when not created yet
+	copiedDeployments map[string]*appsv1.Deployment
+}
+
+func (r *ForkReconciler) collectInventory(ctx context.Context, frk *forkv1beta1.Fork, managerSlug types.NamespacedName) (*forkInventory, error) {
+	inv := &forkInventory{copiedDeployments: map[string]*appsv1.Deployment{}}
+	inNamespace := &client.ListOptions{Namespace: frk.Namespace}
+
+	{
+		svcs := &corev1.ServiceList{}
+		if err := r.List(ctx, svcs, inNamespace); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, svc := range svcs.Items {
+			if metav1.IsControlledBy(&svc, frk) {
+				inv.services = append(inv.services, svc)
+			}
+		}
+	}
+
+	{
+		copies := &ddv1beta1.DeploymentCopyList{}
+		if err := r.List(ctx, copies, inNamespace); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, dc := range copies.Items {
+			if !metav1.IsControlledBy(&dc, frk) {
+				continue
+			}
+			inv.deploymentCopies = append(inv.deploymentCopies, dc)
+
+			// deployment-duplicator names the copied Deployment after `<target>-<suffix>`, which equals to the name of the DeploymentCopy
+			dply := &appsv1.Deployment{}
+			if err := r.Get(ctx, types.NamespacedName{Namespace: dc.Namespace, Name: dc.Name}, dply); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return nil, errors.WithStack(err)
+				}
+				dply = nil
+			}
+			inv.copiedDeployments[dc.Name] = dply
+		}
+	}
+
+	{
+		configs := &forkv1beta1.VSConfigList{}
+		if err := r.List(ctx, configs, inNamespace); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, vsc := range configs.Items {
+			if metav1.IsControlledBy(&vsc, frk) {
+				inv.vsConfigs = append(inv.vsConfigs, vsc)
+			}
+		}
+	}
+
+	{
+		// key: group, kind and name
+		seen := map[string]bool{}
+		for _, gvk := range updater.PreviewGatewayKinds() {
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+			if err := r.List(ctx, list, client.InNamespace(managerSlug.Namespace), client.MatchingLabels{
+				forkv1beta1.ManagerLabelKey:    managerSlug.Name,
+				forkv1beta1.IdentifierLabelKey: frk.Spec.Identifier,
+			}); err != nil {
+				// kinds of preview gateways not used may not be installed
+				if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+					continue
+				}
+				return nil, errors.WithStack(err)
+			}
+			for _, item := range list.Items {
+				// Emissary serves Mappings of both versions as the same resource
+				key := gvk.GroupKind().String() + "/" + item.GetName()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				item.SetGroupVersionKind(gvk)
+				inv.gatewayResources = append(inv.gatewayResources, item)
+			}
+		}
+	}
+
+	return inv, nil
+}
+
+func (inv forkInventory) references() []forkv1beta1.ForkResource {
+	var refs []forkv1beta1.ForkResource
+	add := func(apiVersion, kind string, obj metav1.Object) {
+		refs = append(refs, forkv1beta1.ForkResource{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		})
+	}
+
+	for i := range inv.services {
+		add("v1", "Service", &inv.services[i])
+	}
+	for i := range inv.deploymentCopies {
+		add(ddv1beta1.GroupVersion.String(), "DeploymentCopy", &inv.deploymentCopies[i])
+	}
+	for i := range inv.vsConfigs {
+		add(forkv1beta1.GroupVersion.String(), "VSConfig", &inv.vsConfigs[i])
+	}
+	for i := range inv.gatewayResources {
+		res := &inv.gatewayResources[i]
+		add(res.GetAPIVersion(), res.GetKind(), res)
+	}
+
+	// for less flaky behavior
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].Kind != refs[j].Kind {
+			return refs[i].Kind < refs[j].Kind
+		}
+		return refs[i].Name < refs[j].Name
+	})
+
+	return refs
+}
+
+// mirroredServices returns names of the original Services whose requests are mirrored to their copies
+func (inv forkInventory) mirroredServices() []string {
+	var names []string
+	for _, vsc := range inv.vsConfigs {
+		if vsc.Status.Mirroring {
+			names = append(names, vsc.Spec.Host)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unavailableDeployments returns names of copied Deployments whose replicas are not available yet
+func (inv forkInventory) unavailableDeployments() []string {
+	var names []string
+	for _, dc := range inv.deploymentCopies {
+		dply := inv.copiedDeployments[dc.Name]
+		if dply == nil {
+			names = append(names, dc.Name)
+			continue
+		}
+
+		desired := int32(1)
+		if dply.Spec.Replicas != nil {
+			desired = *dply.Spec.Replicas
+		}
+		if dply.Status.AvailableReplicas < desired {
+			names = append(names, fmt.Sprintf("%s (%d/%d)", dc.Name, dply.Status.AvailableReplicas, desired))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forkPhase summarizes conditions of a fork
+func forkPhase(status forkv1beta1.ForkStatus) forkv1beta1.ForkPhase {
+	for _, t := range []string{
+		forkv1beta1.ForkConditionManagerResolved,
+		forkv1beta1.ForkConditionPolicyCompliant,
+		forkv1beta1.ForkConditionServicesForked,
+		forkv1beta1.ForkConditionRoutingConfigured,
+	} {
+		if meta.IsStatusConditionFalse(status.Conditions, t) {
+			return forkv1beta1.ForkPhaseDegraded
+		}
+	}
+
+	if meta.IsStatusConditionTrue(status.Conditions, forkv1beta1.ForkConditionManagerResolved) &&
+		meta.IsStatusConditionTrue(status.Conditions, forkv1beta1.ForkConditionPolicyCompliant) &&
+		meta.IsStatusConditionTrue(status.Conditions, forkv1beta1.ForkConditionServicesForked) &&
+		meta.IsStatusConditionTrue(status.Conditions, forkv1beta1.ForkConditionRoutingConfigured) &&
+		meta.IsStatusConditionTrue(status.Conditions, forkv1beta1.ForkConditionDeploymentCopiesReady) {
+		return forkv1beta1.ForkPhaseReady
+	}
+
+	return forkv1beta1.ForkPhasePending
+}
@@ -7,48 +7,60 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 type forkWatcher struct {
 	Client   client.Reader
+	Clock    clock.WithTicker
 	channel  chan event.GenericEvent
 	Log      logr.Logger
 	TickTime time.Duration
 }
 
 func (c forkWatcher) Start(ctx context.Context) error {
-	ticker := time.NewTicker(c.TickTime)
+	ticker := c.Clock.NewTicker(c.TickTime)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-ticker.C:
-			now := metav1.NewTime(time.Now())
-			forkList := &forkv1beta1.ForkList{}
-			if err := c.Client.List(ctx, forkList); err != nil {
-				return errors.Wrap(err, "failed to get forkList")
+		case <-ticker.C():
+			if err := c.notifyExpired(ctx); err != nil {
+				// keep watching, the next tick may succeed
+				c.Log.Error(err, "failed to notify expired forks")
 			}
+		}
+	}
+}
 
-			for _, fork := range forkList.Items {
-				// skip fork which doesn't have deadline
-				if fork.Spec.Deadline == nil {
-					continue
-				}
-				// skip fork which is not outdated
-				if fork.Spec.Deadline.After(now.Time) {
-					continue
-				}
-				// notify Reconciler with outdated fork
-				c.channel <- event.GenericEvent{
-					Object: &fork,
-				}
-			}
+// notifyExpired sends forks reaching their deadlines to the channel
+func (c forkWatcher) notifyExpired(ctx context.Context) error {
+	now := c.Clock.Now()
+	forkList := &forkv1beta1.ForkList{}
+	if err := c.Client.List(ctx, forkList); err != nil {
+		return errors.Wrap(err, "failed to get forkList")
+	}
 
+	for i := range forkList.Items {
+		fork := &forkList.Items[i]
+		// skip fork which doesn't have deadline
+		if fork.Spec.Deadline == nil {
+			continue
+		}
+		// skip fork which is not outdated
+		if fork.Spec.Deadline.After(now) {
+			continue
+		}
+		// notify Reconciler with outdated fork
+		select {
+		case c.channel <- event.GenericEvent{Object: fork}:
+		case <-ctx.Done():
+			return nil
 		}
 	}
+	return nil
 }
@@ -0,0 +1,144 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	ambassador "github.com/datawire/ambassador/pkg/api/getambassador.io/v2"
+	"github.com/pkg/errors"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/domain/updater"
+	emissary "github.com/wantedly/kubefork-controller/pkg/api/getambassador.io/v3alpha1"
+	"github.com/wantedly/kubefork-controller/pkg/middleware"
+)
+
+// ForkManagerReconciler reconciles a ForkManager object
+type ForkManagerReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Clock    clock.PassiveClock
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=forkmanagers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=forkmanagers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=forks,verbs=get;list;watch
+// +kubebuilder:rbac:groups=getambassador.io,resources=mappings,verbs=get;list;watch;create;update;patch;delete;deletecollection;
+// +kubebuilder:rbac:groups=getambassador.io,resources=hosts,verbs=get;list;watch;create;update;patch;delete;deletecollection;
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete;deletecollection;
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete;deletecollection;
+
+// Reconcile updates Mappings of the ForkManager and resources of Forks referring to it
+// When the ForkManager is deleted, resources generated for it are removed
+func (r *ForkManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+
+	if err := r.Get(ctx, req.NamespacedName, &forkv1beta1.ForkManager{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, errors.WithStack(r.cleanup(ctx, req.NamespacedName))
+		}
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	up := updater.NewMappingUpdater(r.Client, log.Log, r.Scheme, r.Clock, driftRecorder(r.Recorder, r.Scheme))
+	if err := up.Update(ctx, req.NamespacedName); err != nil {
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	// VSConfigs of the forks follow HeaderKey, and their resources follow the policy of the manager
+	return ctrl.Result{}, errors.WithStack(r.updateForks(ctx, req.NamespacedName))
+}
+
+// cleanup removes Mappings of the deleted ForkManager and resources generated for Forks referring to it
+func (r *ForkManagerReconciler) cleanup(ctx context.Context, managerSlug types.NamespacedName) error {
+	// Mappings are also garbage collected with owner references, this covers ones which lost them
+	for _, gvk := range updater.PreviewGatewayKinds() {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		if err := r.DeleteAllOf(ctx, obj, client.InNamespace(managerSlug.Namespace), client.MatchingLabels{forkv1beta1.ManagerLabelKey: managerSlug.Name}); err != nil {
+			if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(r.updateForks(ctx, managerSlug))
+}
+
+func (r *ForkManagerReconciler) updateForks(ctx context.Context, managerSlug types.NamespacedName) error {
+	forks, err := updater.ForksOfManager(ctx, r.Client, managerSlug)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	mup := updater.NewMicroserviceUpdater(r.Client, log.Log, r.Scheme, r.Clock)
+	for _, f := range forks {
+		if err := mup.Update(ctx, types.NamespacedName{Namespace: f.Namespace, Name: f.Name}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ForkManagerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Clock == nil {
+		r.Clock = clock.RealClock{}
+	}
+
+	bldr := ctrl.NewControllerManagedBy(mgr).
+		// status updates made by this reconciler must not trigger another reconcile
+		For(&forkv1beta1.ForkManager{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// restore Mappings deleted or edited by others
+		Owns(&ambassador.Mapping{})
+
+	// resources of other preview gateways are watched only when they are installed
+	for _, obj := range []client.Object{&emissary.Mapping{}, &emissary.Host{}, &networkingv1.Ingress{}, &gatewayv1beta1.HTTPRoute{}} {
+		gvk, err := apiutil.GVKForObject(obj, mgr.GetScheme())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			if meta.IsNoMatchError(err) {
+				log.Log.Info("skip watching a kind not installed", "kind", gvk.String())
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		bldr = bldr.Owns(obj)
+	}
+
+	return bldr.Complete(middleware.Honeybadger(r))
+}
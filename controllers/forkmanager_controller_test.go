@@ -0,0 +1,303 @@
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ambassador "github.com/datawire/ambassador/pkg/api/getambassador.io/v2"
+	ddv1beta1 "github.com/wantedly/deployment-duplicator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	clock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/controllers"
+	emissary "github.com/wantedly/kubefork-controller/pkg/api/getambassador.io/v3alpha1"
+	ut "github.com/wantedly/kubefork-controller/pkg/testing"
+)
+
+func TestForkManagerReconciler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, forkv1beta1.AddToScheme, ambassador.AddToScheme, emissary.AddToScheme, gatewayv1beta1.AddToScheme, ddv1beta1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2009-11-10T23:00:00Z")
+	managerSlug := types.NamespacedName{Namespace: "ambassador", Name: "default"}
+
+	testcases := []struct {
+		name        string
+		explanation string
+		change      func(ctx context.Context, c client.Client) error
+		// wantErr is whether the reconcile fails, whose result is still recorded
+		wantErr bool
+	}{
+		{
+			name:        "manager changed",
+			explanation: "mappings follow upstreams and VSConfigs follow headerKey, forks of other managers are not served",
+			change: func(ctx context.Context, c client.Client) error {
+				fm := &forkv1beta1.ForkManager{}
+				if err := c.Get(ctx, managerSlug, fm); err != nil {
+					return err
+				}
+				fm.Spec.HeaderKey = "x-new-fork-identifier"
+				fm.Spec.Upstreams = append(fm.Spec.Upstreams[1:], forkv1beta1.Upstream{Host: "another.example.com"})
+				return c.Update(ctx, fm)
+			},
+		},
+		{
+			name:        "preview gateway changed",
+			explanation: "v3alpha1 mappings are generated with the names of v2 mappings, which Emissary serves as the same resource, and hosts are generated for upstreams with tls",
+			change: func(ctx context.Context, c client.Client) error {
+				fm := &forkv1beta1.ForkManager{}
+				if err := c.Get(ctx, managerSlug, fm); err != nil {
+					return err
+				}
+				fm.Spec.PreviewGateway = forkv1beta1.PreviewGatewayEmissaryV3alpha1
+				fm.Spec.Upstreams[0].TLS = &forkv1beta1.UpstreamTLS{SecretName: "wildcard-tls"}
+				fm.Spec.Upstreams = append(fm.Spec.Upstreams, forkv1beta1.Upstream{
+					Host: "another.example.com",
+					TLS:  &forkv1beta1.UpstreamTLS{SecretName: "another-tls", HostMode: forkv1beta1.HostModePerIdentifier},
+				})
+				return c.Update(ctx, fm)
+			},
+		},
+		{
+			name:        "host templates",
+			explanation: "preview hosts are rendered from the templates, and names of mappings are derived from them",
+			change: func(ctx context.Context, c client.Client) error {
+				fm := &forkv1beta1.ForkManager{}
+				if err := c.Get(ctx, managerSlug, fm); err != nil {
+					return err
+				}
+				fm.Spec.Upstreams = []forkv1beta1.Upstream{
+					{Host: "app.example.com", HostTemplate: "{identifier}--app.example.com"},
+					{Host: "preview.example.com", HostTemplate: "app-{identifier}.{host}"},
+					{Host: "long.example.com", HostTemplate: "{identifier}.a-very-long-subdomain-to-exceed-the-limit-of-names.{host}"},
+				}
+				return c.Update(ctx, fm)
+			},
+		},
+		{
+			name:        "routing options",
+			explanation: "mappings follow routing options of the upstreams, and gateway options of the fork override the safe ones except the identifier header",
+			change: func(ctx context.Context, c client.Client) error {
+				fm := &forkv1beta1.ForkManager{}
+				if err := c.Get(ctx, managerSlug, fm); err != nil {
+					return err
+				}
+				fm.Spec.Upstreams = []forkv1beta1.Upstream{
+					{
+						Host:     "api.example.com",
+						Original: "api:8080",
+						Routing: &forkv1beta1.RoutingOptions{
+							Prefix:               "/v1/",
+							Rewrite:              "/",
+							Timeout:              &metav1.Duration{Duration: 30 * time.Second},
+							IdleTimeout:          &metav1.Duration{Duration: 5 * time.Minute},
+							GRPC:                 true,
+							CORS:                 &forkv1beta1.CORSPolicy{Origins: []string{"https://example.com"}, MaxAge: &metav1.Duration{Duration: time.Hour}},
+							RetryPolicy:          &forkv1beta1.RetryPolicy{RetryOn: "5xx", NumRetries: 3, PerTryTimeout: &metav1.Duration{Duration: 1500 * time.Millisecond}},
+							AddRequestHeaders:    map[string]string{"x-preview": "true"},
+							RemoveRequestHeaders: []string{"x-forwarded-host"},
+							AddResponseHeaders:   map[string]string{"x-robots-tag": "noindex"},
+						},
+					},
+				}
+				if err := c.Update(ctx, fm); err != nil {
+					return err
+				}
+
+				frk := &forkv1beta1.Fork{}
+				if err := c.Get(ctx, types.NamespacedName{Namespace: "some-namespace", Name: "some-identifier"}, frk); err != nil {
+					return err
+				}
+				frk.Spec.GatewayOptions = &forkv1beta1.GatewayOptions{
+					AddRequestHeaders:  map[string]string{fm.Spec.HeaderKey: "overridden", "x-debug": "1"},
+					AddResponseHeaders: map[string]string{"x-fork": "some-identifier"},
+					Timeout:            &metav1.Duration{Duration: 2 * time.Minute},
+				}
+				return c.Update(ctx, frk)
+			},
+		},
+		{
+			name:        "ingress preview gateway",
+			explanation: "ingresses adding the header with ingress-nginx annotations are generated in place of mappings",
+			change: func(ctx context.Context, c client.Client) error {
+				fm := &forkv1beta1.ForkManager{}
+				if err := c.Get(ctx, managerSlug, fm); err != nil {
+					return err
+				}
+				fm.Spec.PreviewGateway = forkv1beta1.PreviewGatewayIngress
+				fm.Spec.Ingress = &forkv1beta1.IngressGateway{
+					ClassName:   pointer.String("nginx"),
+					Annotations: map[string]string{"cert-manager.io/cluster-issuer": "letsencrypt"},
+				}
+				fm.Spec.Upstreams = []forkv1beta1.Upstream{
+					{Host: "sandbox.example.com", Original: "sandbox:8080", HostRewrite: "sandbox.example.com"},
+					{Host: "api.example.com", Original: "api.ambassador"},
+				}
+				return c.Update(ctx, fm)
+			},
+		},
+		{
+			name:        "ingress preview gateway with unsafe headers",
+			explanation: "an ingress is not generated when headers of forks could inject nginx configuration, and the upstream reports the error",
+			change: func(ctx context.Context, c client.Client) error {
+				fm := &forkv1beta1.ForkManager{}
+				if err := c.Get(ctx, managerSlug, fm); err != nil {
+					return err
+				}
+				fm.Spec.PreviewGateway = forkv1beta1.PreviewGatewayIngress
+				fm.Spec.Upstreams = []forkv1beta1.Upstream{
+					{Host: "sandbox.example.com", Original: "sandbox:8080"},
+				}
+				if err := c.Update(ctx, fm); err != nil {
+					return err
+				}
+				frk := &forkv1beta1.Fork{}
+				if err := c.Get(ctx, types.NamespacedName{Namespace: "some-namespace", Name: "some-identifier"}, frk); err != nil {
+					return err
+				}
+				frk.Spec.GatewayOptions = &forkv1beta1.GatewayOptions{
+					AddRequestHeaders: map[string]string{"x-some-header": "$host\"; return 200;"},
+				}
+				return c.Update(ctx, frk)
+			},
+			wantErr: true,
+		},
+		{
+			name:        "gateway api preview gateway",
+			explanation: "httproutes setting the header are attached to the gateways in place of mappings",
+			change: func(ctx context.Context, c client.Client) error {
+				fm := &forkv1beta1.ForkManager{}
+				if err := c.Get(ctx, managerSlug, fm); err != nil {
+					return err
+				}
+				fm.Spec.PreviewGateway = forkv1beta1.PreviewGatewayGatewayAPI
+				fm.Spec.GatewayAPI = &forkv1beta1.GatewayAPIGateway{
+					ParentRefs: []forkv1beta1.GatewayReference{{Name: "preview", Namespace: "gateway", SectionName: "https"}},
+				}
+				fm.Spec.Upstreams = []forkv1beta1.Upstream{
+					{Host: "sandbox.example.com", Original: "sandbox:8080", HostRewrite: "sandbox.example.com"},
+					{Host: "api.example.com", Original: "api.api-namespace"},
+				}
+				return c.Update(ctx, fm)
+			},
+		},
+		{
+			name:        "manager deleted",
+			explanation: "mappings and resources generated for forks of the manager are removed",
+			change: func(ctx context.Context, c client.Client) error {
+				return c.Delete(ctx, &forkv1beta1.ForkManager{ObjectMeta: metav1.ObjectMeta{Namespace: managerSlug.Namespace, Name: managerSlug.Name}})
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(now.Add(time.Hour))), ut.AddForkSelector(map[string]string{"app": "some-app"})),
+				ut.GenFork("another-identifier", nil, ut.SetForkManager("ambassador/another")),
+				ut.GenForkManager(),
+				ut.GenDeployment("some-deployment", map[string]string{"app": "some-app", "role": "web"}),
+				ut.GenService("service-for-some-deployment", ut.AddSVCLabel("app", "some-app")),
+			).Build()
+			fakeClock := clock.NewFakeClock(now)
+			ctx := context.Background()
+
+			// generate resources of the fork first
+			forkRec := controllers.ForkReconciler{Client: fakeClient, Scheme: scheme, Clock: fakeClock}
+			if _, err := forkRec.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "some-namespace", Name: "some-identifier"}}); err != nil {
+				t.Fatalf("%+v", err)
+			}
+
+			if err := tc.change(ctx, fakeClient); err != nil {
+				t.Fatalf("%+v", err)
+			}
+
+			rec := controllers.ForkManagerReconciler{
+				Client:   fakeClient,
+				Scheme:   scheme,
+				Clock:    fakeClock,
+				Recorder: record.NewFakeRecorder(10),
+			}
+			if _, err := rec.Reconcile(ctx, ctrl.Request{NamespacedName: managerSlug}); (err != nil) != tc.wantErr {
+				t.Fatalf("wantErr = %t, got %+v", tc.wantErr, err)
+			}
+
+			lists := []client.ObjectList{
+				&ambassador.MappingList{},
+				&emissary.MappingList{},
+				&emissary.HostList{},
+				&networkingv1.IngressList{},
+				&gatewayv1beta1.HTTPRouteList{},
+				&ddv1beta1.DeploymentCopyList{},
+				&corev1.ServiceList{},
+				&forkv1beta1.VSConfigList{},
+				&forkv1beta1.ForkManagerList{},
+			}
+			ifs := make([]interface{}, len(lists))
+			for i, ls := range lists {
+				if err := fakeClient.List(ctx, ls); err != nil {
+					t.Fatalf("%+v", err)
+				}
+				ifs[i] = ls
+			}
+			ut.SnapshotYaml(t, ifs...)
+		})
+	}
+}
+
+func TestForkManagerReconcilerKeepsUnchangedStatus(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, forkv1beta1.AddToScheme, ambassador.AddToScheme, ddv1beta1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2009-11-10T23:00:00Z")
+	managerSlug := types.NamespacedName{Namespace: "ambassador", Name: "default"}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		ut.GenFork("some-identifier", nil, ut.AddForkDeadline(metav1.NewTime(now.Add(time.Hour)))),
+		ut.GenForkManager(),
+	).Build()
+
+	rec := controllers.ForkManagerReconciler{
+		Client:   fakeClient,
+		Scheme:   scheme,
+		Clock:    clock.NewFakeClock(now),
+		Recorder: record.NewFakeRecorder(10),
+	}
+
+	ctx := context.Background()
+	var resourceVersions []string
+	for i := 0; i < 2; i++ {
+		if _, err := rec.Reconcile(ctx, ctrl.Request{NamespacedName: managerSlug}); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		fm := &forkv1beta1.ForkManager{}
+		if err := fakeClient.Get(ctx, managerSlug, fm); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		resourceVersions = append(resourceVersions, fm.ResourceVersion)
+	}
+	if resourceVersions[0] != resourceVersions[1] {
+		t.Errorf("status must not be written again without changes, resourceVersion changed from %s to %s", resourceVersions[0], resourceVersions[1])
+	}
+}
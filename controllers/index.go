@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+)
+
+const (
+	// field index of Forks by `key=value` pairs of `spec.services.selector.matchLabels`
+	forkServiceSelectorField = ".spec.services.selector"
+	// field index of Forks by `key=value` pairs of `spec.deployments.selector.matchLabels`
+	forkDeploymentSelectorField = ".spec.deployments.selector"
+	// indexed for selectors without matchLabels, which can select objects with any labels
+	anyLabelsIndexValue = "*"
+)
+
+// IndexFields registers field indexes used by the controllers
+// It must be called once before the controllers are set up
+func IndexFields(ctx context.Context, mgr ctrl.Manager) error {
+	indexer := mgr.GetFieldIndexer()
+
+	if err := indexer.IndexField(ctx, &forkv1beta1.Fork{}, forkv1beta1.ForkManagerField, func(obj client.Object) []string {
+		return []string{obj.(*forkv1beta1.Fork).Spec.Manager}
+	}); err != nil {
+		return errors.Wrap(err, "failed to index forks")
+	}
+
+	if err := indexer.IndexField(ctx, &forkv1beta1.Fork{}, forkServiceSelectorField, func(obj client.Object) []string {
+		if svcs := obj.(*forkv1beta1.Fork).Spec.Services; svcs != nil {
+			return selectorIndexValues(svcs.Selector)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to index forks")
+	}
+
+	if err := indexer.IndexField(ctx, &forkv1beta1.Fork{}, forkDeploymentSelectorField, func(obj client.Object) []string {
+		if dpls := obj.(*forkv1beta1.Fork).Spec.Deployments; dpls != nil {
+			return selectorIndexValues(dpls.Selector)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to index forks")
+	}
+
+	if err := indexer.IndexField(ctx, &forkv1beta1.VSConfig{}, forkv1beta1.VSConfigHostField, func(obj client.Object) []string {
+		return []string{obj.(*forkv1beta1.VSConfig).Spec.Host}
+	}); err != nil {
+		return errors.Wrap(err, "failed to index vsconfigs")
+	}
+
+	return nil
+}
+
+// selectorIndexValues returns index values of the selector, one of which every object it selects has in labelIndexValues
+func selectorIndexValues(selector *metav1.LabelSelector) []string {
+	// nothing is selected without selector
+	if selector == nil {
+		return nil
+	}
+	if len(selector.MatchLabels) == 0 {
+		return []string{anyLabelsIndexValue}
+	}
+	values := make([]string, 0, len(selector.MatchLabels))
+	for k, v := range selector.MatchLabels {
+		values = append(values, k+"="+v)
+	}
+	return values
+}
+
+// labelIndexValues returns index values to look up selectors which can select an object with the labels
+func labelIndexValues(lbls map[string]string) []string {
+	values := []string{anyLabelsIndexValue}
+	for k, v := range lbls {
+		values = append(values, k+"="+v)
+	}
+	return values
+}
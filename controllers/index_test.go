@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelectorIndexValues(t *testing.T) {
+	testcases := []struct {
+		name     string
+		selector *metav1.LabelSelector
+		labels   map[string]string
+		want     bool
+	}{
+		{
+			name:     "selected by matchLabels",
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "some-app", "role": "web"}},
+			labels:   map[string]string{"app": "some-app", "role": "web", "version": "v1"},
+			want:     true,
+		},
+		{
+			name:     "not selected by matchLabels",
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "some-app"}},
+			labels:   map[string]string{"app": "another-app"},
+		},
+		{
+			name: "selector only with matchExpressions",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpExists},
+			}},
+			labels: map[string]string{"app": "some-app"},
+			want:   true,
+		},
+		{
+			name:   "without selector",
+			labels: map[string]string{"app": "some-app"},
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			indexed := map[string]bool{}
+			for _, v := range selectorIndexValues(tc.selector) {
+				indexed[v] = true
+			}
+			got := false
+			for _, v := range labelIndexValues(tc.labels) {
+				got = got || indexed[v]
+			}
+			if got != tc.want {
+				t.Errorf("looked up = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
@@ -22,35 +22,79 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/pkg/errors"
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
 	"github.com/wantedly/kubefork-controller/domain/updater"
+	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // ServiceReconciler reconciles a Service object
 type ServiceReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// backend of VSConfigs which don't specify it, Istio when empty
+	RoutingBackend forkv1beta1.RoutingBackend
 }
 
-// +kubebuilder:rbac:groups="",resources=services,verbs=gverbs=get;list;watch;
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;
 
+// Reconcile updates the routing resources of the Service when it is targeted by VSConfigs
+// VSConfigs targeting a deleted Service are reported as HostServiceNotFound
 func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
 
-	if err := r.Get(ctx, req.NamespacedName, &corev1.Service{}); err != nil {
-		// since ownerref is correctly set, we don't have to do anything when notfound
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+	configs := &forkv1beta1.VSConfigList{}
+	if err := r.List(ctx, configs, client.InNamespace(req.Namespace), client.MatchingFields{forkv1beta1.VSConfigHostField: req.Name}); err != nil {
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+	// the VirtualService is updated by VSConfigReconciler when the last VSConfig is removed
+	if len(configs.Items) == 0 {
+		return ctrl.Result{}, nil
 	}
 
-	up := updater.NewVirtualServiceUpdater(r.Client, log.Log, r.Scheme)
+	up := updater.NewRoutingUpdater(r.Client, log.Log, r.Scheme, r.RoutingBackend)
 	return ctrl.Result{}, errors.WithStack(up.Update(ctx, req.NamespacedName))
 }
 
+// servicesOfBase enqueues Services which name the VirtualService as their base
+// so that routes of VSConfigs are merged again when the base is changed by others
+func (r *ServiceReconciler) servicesOfBase(obj client.Object) []reconcile.Request {
+	services := &corev1.ServiceList{}
+	if err := r.List(context.Background(), services, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.Log.Error(err, "failed to list services", "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, svc := range services.Items {
+		if svc.Annotations[forkv1beta1.BaseVirtualServiceAnnotationKey] == obj.GetName() {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}})
+		}
+	}
+	return reqs
+}
+
 func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Service{}).
-		Complete(middleware.Honeybadger(r))
+	bldr := ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Service{})
+
+	vs := istio.SchemeGroupVersion.WithKind("VirtualService")
+	if _, err := mgr.GetRESTMapper().RESTMapping(vs.GroupKind(), vs.Version); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return errors.WithStack(err)
+		}
+		log.Log.Info("skip watching a kind not installed", "kind", vs.String())
+	} else {
+		bldr = bldr.Watches(&source.Kind{Type: &istio.VirtualService{}}, handler.EnqueueRequestsFromMapFunc(r.servicesOfBase))
+	}
+
+	return bldr.Complete(middleware.Honeybadger(r))
 }
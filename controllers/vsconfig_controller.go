@@ -36,12 +36,15 @@ import (
 type VSConfigReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// backend of VSConfigs which don't specify it, Istio when empty
+	RoutingBackend forkv1beta1.RoutingBackend
 }
 
 //+kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=vsconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=vsconfigs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=fork.k8s.wantedly.com,resources=vsconfigs/finalizers,verbs=update
 // +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch;create;update;patch;delete;deletecollection;
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -56,7 +59,7 @@ func (r *VSConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	_ = log.FromContext(ctx)
 	ns := req.Namespace
 
-	up := updater.NewVirtualServiceUpdater(r.Client, log.Log, r.Scheme)
+	up := updater.NewRoutingUpdater(r.Client, log.Log, r.Scheme, r.RoutingBackend)
 	instance := forkv1beta1.VSConfig{}
 
 	if err := r.Get(ctx, req.NamespacedName, &instance); err != nil {
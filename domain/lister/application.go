@@ -5,3 +5,5 @@ import (
 )
 
 var NewAppBuilder = application.NewBuilder
+
+var NewEmptyApp = application.NewEmpty
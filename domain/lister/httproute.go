@@ -0,0 +1,169 @@
+package lister
+
+import (
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/pkg/refresh"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// httpRouteRenderer renders routes into a Gateway API HTTPRoute whose parent is the Service (GAMMA)
+type httpRouteRenderer struct{}
+
+func (httpRouteRenderer) ResourceName(service corev1.Service) string {
+	return service.Name
+}
+
+// servicePort returns the port requests are routed to, the first HTTP port or the first port of the service
+func servicePort(service corev1.Service) *gatewayv1beta1.PortNumber {
+	if len(service.Spec.Ports) == 0 {
+		return nil
+	}
+	port := service.Spec.Ports[0]
+	for _, p := range service.Spec.Ports {
+		if p.Name == "http" || (p.AppProtocol != nil && *p.AppProtocol == "http") {
+			port = p
+			break
+		}
+	}
+	pn := gatewayv1beta1.PortNumber(port.Port)
+	return &pn
+}
+
+func (httpRouteRenderer) backendRefs(service string, port *gatewayv1beta1.PortNumber) []gatewayv1beta1.HTTPBackendRef {
+	return []gatewayv1beta1.HTTPBackendRef{
+		{
+			BackendRef: gatewayv1beta1.BackendRef{
+				BackendObjectReference: gatewayv1beta1.BackendObjectReference{
+					Name: gatewayv1beta1.ObjectName(service),
+					Port: port,
+				},
+			},
+		},
+	}
+}
+
+// buildMatches returns matches of the route, any of which routes requests
+// Prefix matches are rendered as regular expressions because HTTPRoutes don't support them
+func (httpRouteRenderer) buildMatches(route Route) []gatewayv1beta1.HTTPRouteMatch {
+	var matches []gatewayv1beta1.HTTPRouteMatch
+	for _, m := range matchesOf(route) {
+		value := m.value
+		if m.prefix {
+			value = prefixRegex(m.value)
+		}
+		match := gatewayv1beta1.HTTPRouteMatch{}
+		if m.query {
+			matchType := gatewayv1beta1.QueryParamMatchExact
+			if m.regex || m.prefix {
+				matchType = gatewayv1beta1.QueryParamMatchRegularExpression
+			}
+			match.QueryParams = []gatewayv1beta1.HTTPQueryParamMatch{{Type: &matchType, Name: m.name, Value: value}}
+		} else {
+			matchType := gatewayv1beta1.HeaderMatchExact
+			if m.regex || m.prefix {
+				matchType = gatewayv1beta1.HeaderMatchRegularExpression
+			}
+			match.Headers = []gatewayv1beta1.HTTPHeaderMatch{{Type: &matchType, Name: gatewayv1beta1.HTTPHeaderName(m.name), Value: value}}
+		}
+		matches = append(matches, scopeMatches(match, route.Scope)...)
+	}
+	return matches
+}
+
+// scopeMatches narrows the match with the scope
+// A match has a single method, so the match is repeated for each method
+func scopeMatches(match gatewayv1beta1.HTTPRouteMatch, scope *forkv1beta1.RouteScope) []gatewayv1beta1.HTTPRouteMatch {
+	if scope == nil {
+		return []gatewayv1beta1.HTTPRouteMatch{match}
+	}
+
+	switch {
+	case scope.URIPrefix != "":
+		pathType := gatewayv1beta1.PathMatchPathPrefix
+		match.Path = &gatewayv1beta1.HTTPPathMatch{Type: &pathType, Value: pointer.String(scope.URIPrefix)}
+	case scope.URIRegex != "":
+		pathType := gatewayv1beta1.PathMatchRegularExpression
+		match.Path = &gatewayv1beta1.HTTPPathMatch{Type: &pathType, Value: pointer.String(scope.URIRegex)}
+	}
+	if len(scope.Methods) == 0 {
+		return []gatewayv1beta1.HTTPRouteMatch{match}
+	}
+
+	matches := make([]gatewayv1beta1.HTTPRouteMatch, len(scope.Methods))
+	for i, method := range scope.Methods {
+		m := *match.DeepCopy()
+		httpMethod := gatewayv1beta1.HTTPMethod(method)
+		m.Method = &httpMethod
+		matches[i] = m
+	}
+	return matches
+}
+
+func (r httpRouteRenderer) buildRules(service corev1.Service, routes []Route) []gatewayv1beta1.HTTPRouteRule {
+	port := servicePort(service)
+
+	var rules []gatewayv1beta1.HTTPRouteRule
+	for _, route := range routes {
+		rules = append(rules, gatewayv1beta1.HTTPRouteRule{
+			Matches:     r.buildMatches(route),
+			BackendRefs: r.backendRefs(route.Destination, port),
+		})
+	}
+
+	// a rule without matches is the default
+	fallback := gatewayv1beta1.HTTPRouteRule{
+		BackendRefs: r.backendRefs(service.Name, port),
+	}
+	for _, route := range routes {
+		if route.Weight == 0 {
+			continue
+		}
+		canary := r.backendRefs(route.Destination, port)[0]
+		canary.Weight = pointer.Int32(route.Weight)
+		fallback.BackendRefs[0].Weight = pointer.Int32(100 - route.Weight)
+		fallback.BackendRefs = append(fallback.BackendRefs, canary)
+		break
+	}
+	return append(rules, fallback)
+}
+
+func (r httpRouteRenderer) Render(service corev1.Service, routes []Route) refresh.ObjectList {
+	var list []client.Object
+	if len(routes) != 0 {
+		group := gatewayv1beta1.Group(corev1.GroupName)
+		kind := gatewayv1beta1.Kind("Service")
+		list = append(list, &gatewayv1beta1.HTTPRoute{
+			TypeMeta: v1.TypeMeta{
+				Kind:       "HTTPRoute",
+				APIVersion: gatewayv1beta1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: v1.ObjectMeta{
+				Name:      r.ResourceName(service),
+				Namespace: service.Namespace,
+				Labels: map[string]string{
+					labelKeyForVS: service.Name,
+				},
+			},
+			Spec: gatewayv1beta1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1beta1.CommonRouteSpec{
+					ParentRefs: []gatewayv1beta1.ParentReference{
+						{Group: &group, Kind: &kind, Name: gatewayv1beta1.ObjectName(service.Name)},
+					},
+				},
+				Rules: r.buildRules(service, routes),
+			},
+		})
+	}
+
+	return refresh.ObjectList{
+		Items:            list,
+		GroupVersionKind: gatewayv1beta1.SchemeGroupVersion.WithKind("HTTPRouteList"),
+		Identity: func(obj client.Object) (string, error) {
+			return obj.GetName(), nil
+		},
+	}
+}
@@ -23,8 +23,15 @@ type app struct {
 	// key - deployment name
 	// value - a list of services that routes to the deployment of the key
 	deployNameToServiceNames map[string][]string
-	forkHeader               string
+	manager                  forkv1beta1.ForkManagerSpec
 	fork                     forkv1beta1.Fork
+	// canaryWeight is the current weight of the canary policy of the fork
+	canaryWeight int32
+}
+
+// NewEmpty returns an app without any resources, which makes Refresher delete all resources owned by the fork
+func NewEmpty(fork forkv1beta1.Fork) refresh.Lister {
+	return &app{fork: fork}
 }
 
 func (a app) GenerateLists() []refresh.ObjectList {
@@ -61,7 +68,7 @@ func (a app) generateServices() refresh.ObjectList {
 	svcs := make([]client.Object, len(a.services))
 	for i, svc := range a.services {
 		obj := copyableService(svc).buildCopy(a.fork, a.existingCopiedServices)
-		obj.Labels = mergeMap(obj.Labels, map[string]string{labelKey: svc.Name, forkIdentiferLabelKey: a.fork.Spec.Identifier})
+		obj.Labels = mergeMap(obj.Labels, map[string]string{labelKey: svc.Name, forkv1beta1.IdentifierLabelKey: a.fork.Spec.Identifier})
 		svcs[i] = obj
 	}
 
@@ -83,7 +90,7 @@ func (a app) generateServices() refresh.ObjectList {
 func (a app) generateVSConfigs() refresh.ObjectList {
 	svcs := make([]client.Object, len(a.services))
 	for i, svc := range a.services {
-		svcs[i] = copyableService(svc).buildVSConfig(a.fork, a.forkHeader)
+		svcs[i] = copyableService(svc).buildVSConfig(a.fork, a.manager, a.canaryWeight)
 	}
 
 	return refresh.ObjectList{
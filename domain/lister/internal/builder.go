@@ -4,6 +4,7 @@ import (
 	"context"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
@@ -18,21 +19,24 @@ import (
 	"github.com/wantedly/kubefork-controller/pkg/refresh"
 )
 
-func NewBuilder(reader client.Reader, fork forkv1beta1.Fork) refresh.Builder {
+// NewBuilder returns a Builder of resources of the fork at the time, which decides the weight of its canary policy
+func NewBuilder(reader client.Reader, fork forkv1beta1.Fork, now time.Time) refresh.Builder {
 	return builder{
 		reader,
 		fork,
+		now,
 	}
 }
 
 type builder struct {
 	reader client.Reader
 	fork   forkv1beta1.Fork
+	now    time.Time
 }
 
 // Build collects information to build Application
 func (b builder) Build(ctx context.Context) (refresh.Lister, error) {
-	forkHeader, err := b.getForkHeaderKey(ctx)
+	fm, err := b.getForkManager(ctx)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -66,22 +70,24 @@ func (b builder) Build(ctx context.Context) (refresh.Lister, error) {
 	// for less flaky behavior
 	sort.Slice(deploys, func(i, j int) bool { return deploys[i].Name < deploys[j].Name })
 
-	return &app{services, deploys, existingCopiedServices, inverseMap(serviceNameToDeployName), forkHeader, b.fork}, nil
+	canaryWeight, _ := b.fork.Spec.CanaryWeightAt(b.fork.CreationTimestamp.Time, b.now)
+
+	return &app{services, deploys, existingCopiedServices, inverseMap(serviceNameToDeployName), fm.Spec, b.fork, canaryWeight}, nil
 }
 
-func (b builder) getForkHeaderKey(ctx context.Context) (string, error) {
+func (b builder) getForkManager(ctx context.Context) (*forkv1beta1.ForkManager, error) {
 	slugParts := strings.Split(b.fork.Spec.Manager, "/")
 	if len(slugParts) != 2 {
-		return "", errors.New("malformed field `manager`")
+		return nil, errors.New("malformed field `manager`")
 	}
 
 	managerSlug := types.NamespacedName{Namespace: slugParts[0], Name: slugParts[1]}
 
 	fm := &forkv1beta1.ForkManager{}
 	if err := b.reader.Get(ctx, managerSlug, fm); err != nil {
-		return "", errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
-	return fm.Spec.HeaderKey, nil
+	return fm, nil
 }
 
 func (b builder) forkTargetServices(ctx context.Context) ([]corev1.Service, error) {
@@ -107,7 +113,7 @@ func (b builder) existingForkedServices(ctx context.Context) (map[string]corev1.
 	serviceList := &corev1.ServiceList{}
 	{ // list all services that are already forked
 		labelKV := map[string][]string{
-			forkIdentiferLabelKey: {b.fork.Spec.Identifier},
+			forkv1beta1.IdentifierLabelKey: {b.fork.Spec.Identifier},
 		}
 		ls := labels.Everything()
 		for k, v := range labelKV {
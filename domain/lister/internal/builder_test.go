@@ -3,6 +3,7 @@ package application_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	ddv1beta1 "github.com/wantedly/deployment-duplicator/api/v1beta1"
 	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
@@ -146,7 +147,7 @@ func TestBuild(t *testing.T) {
 			fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
 
 			fork.Spec.Deployments.Replicas = tc.replicas
-			builder := application.NewBuilder(fakeClient, fork)
+			builder := application.NewBuilder(fakeClient, fork, time.Now())
 			ctx := context.Background()
 			app, err := builder.Build(ctx)
 			if err != nil {
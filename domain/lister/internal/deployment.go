@@ -17,14 +17,18 @@ func (d copyableDeployment) buildCopy(fork forkv1beta1.Fork, serviceNames []stri
 	name := fmt.Sprintf("%s-%s", d.Name, fork.Name)
 
 	return &ddv1beta1.DeploymentCopy{
-		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: fork.Namespace},
-		Spec:       d.buildDeploymentCopySpec(fork, serviceNames),
+		ObjectMeta: v1.ObjectMeta{
+			Name:      name,
+			Namespace: fork.Namespace,
+			Labels:    map[string]string{forkv1beta1.IdentifierLabelKey: fork.Spec.Identifier},
+		},
+		Spec: d.buildDeploymentCopySpec(fork, serviceNames),
 	}
 }
 
 func (d copyableDeployment) buildDeploymentCopySpec(fork forkv1beta1.Fork, serviceNames []string) ddv1beta1.DeploymentCopySpec {
 	labels := map[string]string{
-		forkIdentiferLabelKey: fork.Spec.Identifier,
+		forkv1beta1.IdentifierLabelKey: fork.Spec.Identifier,
 	}
 	for _, s := range serviceNames {
 		labels[getLabelKeyforRoutingLabel(s)] = "true"
@@ -15,8 +15,6 @@ func getLabelKeyforRoutingLabel(originalServiceName string) string {
 	return fmt.Sprintf("%s-%s", routingLabelKeyPrefix, originalServiceName)
 }
 
-const forkIdentiferLabelKey = "fork.k8s.wantedly.com/identifier"
-
 func (s copyableService) buildCopy(fork forkv1beta1.Fork, existingService map[string]corev1.Service) *corev1.Service {
 	copiedSpec := s.Spec.DeepCopy()
 	spec := corev1.ServiceSpec{}
@@ -40,7 +38,7 @@ func (s copyableService) buildCopy(fork forkv1beta1.Fork, existingService map[st
 
 	spec.Selector = map[string]string{
 		getLabelKeyforRoutingLabel(s.Name): "true",
-		forkIdentiferLabelKey:              fork.Spec.Identifier,
+		forkv1beta1.IdentifierLabelKey:     fork.Spec.Identifier,
 	}
 
 	return &corev1.Service{
@@ -55,16 +53,30 @@ func (s copyableService) serviceName(fork forkv1beta1.Fork) string {
 	return fmt.Sprintf("%s-%s", s.Name, fork.Name)
 }
 
-func (s copyableService) buildVSConfig(fork forkv1beta1.Fork, headerName string) *forkv1beta1.VSConfig {
+func (s copyableService) buildVSConfig(fork forkv1beta1.Fork, manager forkv1beta1.ForkManagerSpec, canaryWeight int32) *forkv1beta1.VSConfig {
 	name := s.serviceName(fork)
 
-	return &forkv1beta1.VSConfig{
-		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: fork.Namespace},
+	vsc := &forkv1beta1.VSConfig{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      name,
+			Namespace: fork.Namespace,
+			Labels:    map[string]string{forkv1beta1.IdentifierLabelKey: fork.Spec.Identifier},
+		},
 		Spec: forkv1beta1.VSConfigSpec{
 			Host:        s.Name,
 			Service:     s.serviceName(fork),
-			HeaderName:  headerName,
+			HeaderName:  manager.HeaderKey,
 			HeaderValue: fork.Spec.Identifier,
+			Scope:       fork.Spec.Services.ScopeOf(s.Name),
+			Mirror:      fork.Spec.Mirror,
+			Weight:      canaryWeight,
+			Backend:     manager.RoutingBackend,
 		},
 	}
+	if m := manager.IdentifierMatch; m != nil {
+		vsc.Spec.MatchType = m.Type
+		vsc.Spec.Pattern = m.Pattern
+		vsc.Spec.MatchName = m.Name
+	}
+	return vsc
 }
@@ -0,0 +1,59 @@
+package lister
+
+import (
+	"regexp"
+	"strings"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+)
+
+// cookieHeader is the header cookies of requests are sent with
+const cookieHeader = "cookie"
+
+// headerMatch is a match of a header or a query parameter which a Route is rendered into
+type headerMatch struct {
+	// query is true when the match is of a query parameter
+	query bool
+	name  string
+	// regex is true when value is a regular expression, otherwise it is matched exactly
+	regex bool
+	value string
+	// prefix is true when value is matched as a prefix, which is only used by backends supporting it
+	prefix bool
+}
+
+// matchesOf returns matches of which requests are routed by any
+// Cookie and QueryParam also match the header so that requests propagating the header are routed
+func matchesOf(route Route) []headerMatch {
+	exact := headerMatch{name: route.HeaderName, value: route.HeaderValue}
+	switch route.MatchType {
+	case forkv1beta1.MatchTypePrefix:
+		return []headerMatch{{name: route.HeaderName, value: route.HeaderValue, prefix: true}}
+	case forkv1beta1.MatchTypeRegex:
+		return []headerMatch{{name: route.HeaderName, value: route.Pattern, regex: true}}
+	case forkv1beta1.MatchTypeCookie:
+		return []headerMatch{exact, {name: cookieHeader, value: cookieRegex(route.ParamName, route.HeaderValue), regex: true}}
+	case forkv1beta1.MatchTypeQueryParam:
+		return []headerMatch{exact, {query: true, name: route.ParamName, value: route.HeaderValue}}
+	}
+	return []headerMatch{exact}
+}
+
+// cookieRegex returns a regular expression of the Cookie header which has the cookie `name=value`
+func cookieRegex(name, value string) string {
+	return `^(.*;\s*)?` + regexp.QuoteMeta(name) + "=" + regexp.QuoteMeta(value) + `(;.*)?$`
+}
+
+// prefixRegex returns a regular expression matching values starting with the prefix
+func prefixRegex(prefix string) string {
+	return "^" + regexp.QuoteMeta(prefix) + ".*"
+}
+
+// methodsRegex returns a regular expression matching any of the methods
+func methodsRegex(methods []string) string {
+	quoted := make([]string, len(methods))
+	for i, method := range methods {
+		quoted[i] = regexp.QuoteMeta(method)
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
@@ -0,0 +1,348 @@
+package lister
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/pkg/refresh"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
+	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	labelKeyForVS = "fork.k8s.wantedly.com/service"
+)
+
+// VSConfigReporter reports how each VSConfig is reflected to the routing resources
+type VSConfigReporter interface {
+	// OutdatedVSConfigs returns VSConfigs targeting the service whose status has to be updated
+	OutdatedVSConfigs() []forkv1beta1.VSConfig
+}
+
+// Route routes requests with the header to Destination
+type Route struct {
+	HeaderName  string
+	HeaderValue string
+	// MatchType tells how requests are matched, see forkv1beta1.MatchType
+	MatchType forkv1beta1.MatchType
+	// Pattern is the rendered regular expression of the Regex MatchType
+	Pattern string
+	// ParamName is the name of the cookie or the query parameter of the Cookie and QueryParam MatchType
+	ParamName string
+	// Scope narrows requests routed, nil when all requests with the header are routed
+	Scope *forkv1beta1.RouteScope
+	// Destination is the name of the Service to route to
+	Destination string
+	// Mirror shadows requests which match none of the routes to Destination, nil when not mirrored
+	Mirror *forkv1beta1.MirrorPolicy
+	// Weight is the percentage of requests which match none of the routes sent to Destination
+	Weight int32
+}
+
+// Renderer renders routes to a Service into resources of a routing backend
+// Requests which match none of the routes must be sent to the Service itself
+type Renderer interface {
+	// Render returns the resources for the routes, which must be empty when there are no routes
+	Render(service corev1.Service, routes []Route) refresh.ObjectList
+}
+
+// VirtualServiceMerger merges routes into VirtualServices which are not owned by the Service
+type VirtualServiceMerger interface {
+	// MergedVirtualServices returns base VirtualServices whose routes have to be updated
+	MergedVirtualServices() []client.Object
+}
+
+// NewRoutingBuilder returns a Builder of routing resources of the Service
+// VSConfigs without backend are rendered with defaultBackend
+func NewRoutingBuilder(r client.Reader, serviceSlug types.NamespacedName, defaultBackend forkv1beta1.RoutingBackend) refresh.Builder {
+	return &builder{
+		r,
+		serviceSlug,
+		defaultBackend,
+	}
+}
+
+type builder struct {
+	r              client.Reader
+	serviceSlug    types.NamespacedName
+	defaultBackend forkv1beta1.RoutingBackend
+}
+
+type routingLister struct {
+	sortedConfigs  []forkv1beta1.VSConfig
+	service        corev1.Service
+	defaultBackend forkv1beta1.RoutingBackend
+	virtualService virtualServiceRenderer
+}
+
+// renderers returns routing backends in the order of rendering
+// All of them render every time so that resources of a backend no longer used are deleted
+func (a routingLister) renderers() []struct {
+	backend  forkv1beta1.RoutingBackend
+	renderer Renderer
+} {
+	return []struct {
+		backend  forkv1beta1.RoutingBackend
+		renderer Renderer
+	}{
+		{forkv1beta1.RoutingBackendIstio, a.virtualService},
+		{forkv1beta1.RoutingBackendGatewayAPI, httpRouteRenderer{}},
+	}
+}
+
+func (b builder) Build(ctx context.Context) (refresh.Lister, error) {
+	var sortedConfigs []forkv1beta1.VSConfig
+	{
+		configs := &forkv1beta1.VSConfigList{}
+		err := b.r.List(ctx, configs, client.InNamespace(b.serviceSlug.Namespace), client.MatchingFields{forkv1beta1.VSConfigHostField: b.serviceSlug.Name})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		sort.Slice(configs.Items, func(i, j int) bool { return configs.Items[i].ObjectMeta.Name < configs.Items[j].ObjectMeta.Name })
+		sortedConfigs = configs.Items
+	}
+	service := corev1.Service{}
+	if err := b.r.Get(ctx, b.serviceSlug, &service); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	vs, err := b.buildVirtualServiceRenderer(ctx, service)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &routingLister{sortedConfigs: sortedConfigs, service: service, defaultBackend: b.defaultBackend, virtualService: vs}, nil
+}
+
+// buildVirtualServiceRenderer reads the base VirtualService or the route template given with annotations of the service
+func (b builder) buildVirtualServiceRenderer(ctx context.Context, service corev1.Service) (virtualServiceRenderer, error) {
+	var r virtualServiceRenderer
+	if name := service.Annotations[forkv1beta1.BaseVirtualServiceAnnotationKey]; name != "" {
+		r.baseName = name
+		base := &istio.VirtualService{}
+		if err := b.r.Get(ctx, types.NamespacedName{Namespace: service.Namespace, Name: name}, base); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return r, errors.WithStack(err)
+			}
+			base = nil
+		}
+		r.base = base
+	}
+
+	merged := &istio.VirtualServiceList{}
+	if err := b.r.List(ctx, merged, client.InNamespace(service.Namespace), client.MatchingLabels{labelKeyForVS: service.Name}); err != nil {
+		// there is nothing merged when Istio is not installed
+		if !meta.IsNoMatchError(err) && !runtime.IsNotRegisteredError(err) {
+			return r, errors.WithStack(err)
+		}
+	}
+	for _, vs := range merged.Items {
+		if vs.Name == r.baseName || metav1.IsControlledBy(vs, &service) {
+			continue
+		}
+		r.formerBases = append(r.formerBases, vs)
+	}
+
+	if tmpl := service.Annotations[forkv1beta1.RouteTemplateAnnotationKey]; tmpl != "" {
+		r.template = &networkingv1beta1.HTTPRoute{}
+		if err := r.template.UnmarshalJSON([]byte(tmpl)); err != nil {
+			return r, errors.Wrapf(err, "invalid %s annotation of service %s", forkv1beta1.RouteTemplateAnnotationKey, service.Name)
+		}
+	}
+	return r, nil
+}
+
+func (a routingLister) GenerateLists() []refresh.ObjectList {
+	renderers := a.renderers()
+	res := make([]refresh.ObjectList, len(renderers))
+	for i, r := range renderers {
+		res[i] = r.renderer.Render(a.service, a.routesOf(r.backend))
+	}
+	return res
+}
+
+func (a routingLister) MergedVirtualServices() []client.Object {
+	var objs []client.Object
+	for _, vs := range a.virtualService.Merge(a.service, a.routesOf(forkv1beta1.RoutingBackendIstio)) {
+		objs = append(objs, vs)
+	}
+	return objs
+}
+
+// routesOf returns routes of VSConfigs to be rendered with the backend
+func (a routingLister) routesOf(backend forkv1beta1.RoutingBackend) []Route {
+	rendered, _ := a.classifyConfigs()
+
+	var routes []Route
+	for _, config := range rendered {
+		if a.backendOf(config) != backend {
+			continue
+		}
+		// patterns of rendered configs are valid
+		pattern, _ := config.Spec.HeaderRegex()
+		routes = append(routes, Route{
+			HeaderName:  config.Spec.HeaderName,
+			HeaderValue: config.Spec.HeaderValue,
+			MatchType:   config.Spec.Match(),
+			Pattern:     pattern,
+			ParamName:   config.Spec.ParamName(),
+			Scope:       config.Spec.Scope,
+			Destination: config.Spec.Service,
+			Mirror:      config.Spec.Mirror,
+			Weight:      config.Spec.Weight,
+		})
+	}
+	return routes
+}
+
+func (a routingLister) backendOf(config forkv1beta1.VSConfig) forkv1beta1.RoutingBackend {
+	if config.Spec.Backend == "" {
+		return a.defaultBackend
+	}
+	return config.Spec.Backend
+}
+
+// classifyConfigs splits VSConfigs targeting the service into ones to be rendered in order and ones to be skipped
+func (a routingLister) classifyConfigs() ([]forkv1beta1.VSConfig, map[string]forkv1beta1.VSConfigStatus) {
+	var rendered []forkv1beta1.VSConfig
+	skipped := map[string]forkv1beta1.VSConfigStatus{}
+
+	// key: header name and value
+	// value: name of VSConfig which routes the header
+	routedHeaders := map[[2]string]string{}
+	// name of VSConfig which mirrors requests to the service
+	mirroredBy := ""
+	// name of VSConfig which a weight of requests to the service is sent to
+	weightedBy := ""
+	for _, config := range a.sortedConfigs {
+		if config.Spec.Host != a.service.Name {
+			continue
+		}
+		if config.Spec.HeaderValue == "" {
+			skipped[config.Name] = forkv1beta1.VSConfigStatus{
+				Reason:  forkv1beta1.VSConfigReasonEmptyHeaderValue,
+				Message: "headerValue must not be empty",
+			}
+			continue
+		}
+		if config.Spec.Match() == forkv1beta1.MatchTypeRegex {
+			if _, err := config.Spec.HeaderRegex(); err != nil {
+				skipped[config.Name] = forkv1beta1.VSConfigStatus{
+					Reason:  forkv1beta1.VSConfigReasonInvalidPattern,
+					Message: err.Error(),
+				}
+				continue
+			}
+		}
+		if a.backendOf(config) == forkv1beta1.RoutingBackendIstio && a.virtualService.baseName != "" && a.virtualService.base == nil {
+			skipped[config.Name] = forkv1beta1.VSConfigStatus{
+				Reason:  forkv1beta1.VSConfigReasonBaseNotFound,
+				Message: fmt.Sprintf("VirtualService %s is not found", a.virtualService.baseName),
+			}
+			continue
+		}
+		if a.backendOf(config) == forkv1beta1.RoutingBackendGatewayAPI && config.Spec.Scope != nil && config.Spec.Scope.Port != nil {
+			skipped[config.Name] = forkv1beta1.VSConfigStatus{
+				Reason:  forkv1beta1.VSConfigReasonUnsupportedScope,
+				Message: fmt.Sprintf("scope.port is not supported by the %s backend", forkv1beta1.RoutingBackendGatewayAPI),
+			}
+			continue
+		}
+		header := [2]string{config.Spec.HeaderName, config.Spec.HeaderValue}
+		if other, ok := routedHeaders[header]; ok {
+			skipped[config.Name] = forkv1beta1.VSConfigStatus{
+				Reason:  forkv1beta1.VSConfigReasonConflictingIdentifier,
+				Message: fmt.Sprintf("VSConfig %s already routes %s: %s", other, config.Spec.HeaderName, config.Spec.HeaderValue),
+			}
+			continue
+		}
+		if config.Spec.Mirror != nil {
+			if a.backendOf(config) != forkv1beta1.RoutingBackendIstio {
+				skipped[config.Name] = forkv1beta1.VSConfigStatus{
+					Reason:  forkv1beta1.VSConfigReasonUnsupportedMirror,
+					Message: fmt.Sprintf("mirror is not supported by the %s backend", a.backendOf(config)),
+				}
+				continue
+			}
+			if mirroredBy != "" {
+				skipped[config.Name] = forkv1beta1.VSConfigStatus{
+					Reason:  forkv1beta1.VSConfigReasonConflictingMirror,
+					Message: fmt.Sprintf("VSConfig %s already mirrors requests to %s", mirroredBy, a.service.Name),
+				}
+				continue
+			}
+			mirroredBy = config.Name
+		}
+		if config.Spec.Weight > 0 {
+			if weightedBy != "" {
+				skipped[config.Name] = forkv1beta1.VSConfigStatus{
+					Reason:  forkv1beta1.VSConfigReasonConflictingCanary,
+					Message: fmt.Sprintf("VSConfig %s already sends a weight of requests to %s", weightedBy, a.service.Name),
+				}
+				continue
+			}
+			weightedBy = config.Name
+		}
+		routedHeaders[header] = config.Name
+		rendered = append(rendered, config)
+	}
+
+	return rendered, skipped
+}
+
+func (a routingLister) OutdatedVSConfigs() []forkv1beta1.VSConfig {
+	rendered, skipped := a.classifyConfigs()
+
+	statuses := map[string]forkv1beta1.VSConfigStatus{}
+	// key: backend
+	// value: number of routes rendered with the backend so far
+	indexes := map[forkv1beta1.RoutingBackend]int32{}
+	for _, config := range rendered {
+		backend := a.backendOf(config)
+		st := forkv1beta1.VSConfigStatus{
+			Rendered:   true,
+			Backend:    backend,
+			Mirroring:  config.Spec.Mirror != nil,
+			RouteIndex: pointer.Int32(indexes[backend]),
+		}
+		indexes[backend]++
+		switch backend {
+		case forkv1beta1.RoutingBackendIstio:
+			st.VirtualService = a.virtualService.ResourceName(a.service)
+		case forkv1beta1.RoutingBackendGatewayAPI:
+			st.HTTPRoute = httpRouteRenderer{}.ResourceName(a.service)
+		}
+		statuses[config.Name] = st
+	}
+	for name, st := range skipped {
+		statuses[name] = st
+	}
+
+	var outdated []forkv1beta1.VSConfig
+	for _, config := range a.sortedConfigs {
+		st, ok := statuses[config.Name]
+		if !ok {
+			continue
+		}
+		st.ObservedGeneration = config.Generation
+		if equality.Semantic.DeepEqual(config.Status, st) {
+			continue
+		}
+		config.Status = st
+		outdated = append(outdated, config)
+	}
+
+	return outdated
+}
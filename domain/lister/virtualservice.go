@@ -1,11 +1,10 @@
 package lister
 
 import (
-	"context"
-	"sort"
+	"bytes"
+	"strings"
 
 	"github.com/pkg/errors"
-	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
 	"github.com/wantedly/kubefork-controller/pkg/refresh"
 	networkingv1beta1 "istio.io/api/networking/v1beta1"
 	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
@@ -13,125 +12,296 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-const (
-	labelKeyForVS = "fork.k8s.wantedly.com/service"
-)
+// forkRoutePrefix is the prefix of names of routes merged into base VirtualServices
+// Routes with the prefix are replaced on every merge, and the others are kept
+const forkRoutePrefix = "kubefork-"
+
+// virtualServiceRenderer renders routes into an Istio VirtualService
+// With a base VirtualService, routes are merged into it instead of the VirtualService owned by the Service
+type virtualServiceRenderer struct {
+	// baseName is the name of the base VirtualService given with the annotation of the Service
+	baseName string
+	// base is nil when the base VirtualService is missing
+	base *istio.VirtualService
+	// formerBases are VirtualServices routes were merged into, which are not the base anymore
+	formerBases []*istio.VirtualService
+	// template is a route whose policies the routes of the owned VirtualService inherit
+	template *networkingv1beta1.HTTPRoute
+}
 
-func NewVirtualServiceBuilder(r client.Reader, serviceSlug types.NamespacedName) refresh.Builder {
-	return &builder{
-		r,
-		serviceSlug,
+func (r virtualServiceRenderer) ResourceName(service corev1.Service) string {
+	if r.baseName != "" {
+		return r.baseName
 	}
+	return service.Name
 }
 
-type builder struct {
-	r           client.Reader
-	serviceSlug types.NamespacedName
+// inheritRoute returns a route to the destination with the policies of the route
+// Conditions and actions other than routing to a destination are not inherited
+func inheritRoute(policy *networkingv1beta1.HTTPRoute, destination string) *networkingv1beta1.HTTPRoute {
+	route := &networkingv1beta1.HTTPRoute{}
+	if policy != nil {
+		route = policy.DeepCopy()
+		route.Name = ""
+		route.Match = nil
+		route.Redirect = nil
+		route.DirectResponse = nil
+		route.Delegate = nil
+	}
+
+	dest := &networkingv1beta1.HTTPRouteDestination{}
+	if len(route.Route) > 0 {
+		// the port and headers of the first destination are kept, subsets and weights don't apply to the destination
+		dest = route.Route[0].DeepCopy()
+		dest.Weight = 0
+	}
+	if dest.Destination == nil {
+		dest.Destination = &networkingv1beta1.Destination{}
+	}
+	dest.Destination.Host = destination
+	dest.Destination.Subset = ""
+	route.Route = []*networkingv1beta1.HTTPRouteDestination{dest}
+	return route
+}
+
+// buildMatches returns matches of the route, any of which routes requests
+func (virtualServiceRenderer) buildMatches(route Route) []*networkingv1beta1.HTTPMatchRequest {
+	var matches []*networkingv1beta1.HTTPMatchRequest
+	for _, m := range matchesOf(route) {
+		sm := &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Exact{Exact: m.value}}
+		switch {
+		case m.regex:
+			sm.MatchType = &networkingv1beta1.StringMatch_Regex{Regex: m.value}
+		case m.prefix:
+			sm.MatchType = &networkingv1beta1.StringMatch_Prefix{Prefix: m.value}
+		}
+		match := &networkingv1beta1.HTTPMatchRequest{}
+		if m.query {
+			match.QueryParams = map[string]*networkingv1beta1.StringMatch{m.name: sm}
+		} else {
+			match.Headers = map[string]*networkingv1beta1.StringMatch{m.name: sm}
+		}
+		if scope := route.Scope; scope != nil {
+			switch {
+			case scope.URIPrefix != "":
+				match.Uri = &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Prefix{Prefix: scope.URIPrefix}}
+			case scope.URIRegex != "":
+				match.Uri = &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Regex{Regex: scope.URIRegex}}
+			}
+			switch len(scope.Methods) {
+			case 0:
+			case 1:
+				match.Method = &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Exact{Exact: scope.Methods[0]}}
+			default:
+				match.Method = &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Regex{Regex: methodsRegex(scope.Methods)}}
+			}
+			if scope.Port != nil {
+				match.Port = uint32(*scope.Port)
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches
 }
 
-type vsLister struct {
-	sortedConfigs []forkv1beta1.VSConfig
-	service       corev1.Service
+func (r virtualServiceRenderer) buildHTTPRoutes(service corev1.Service, routes []Route) []*networkingv1beta1.HTTPRoute {
+	var httpRoutes []*networkingv1beta1.HTTPRoute
+	for _, route := range routes {
+		httpRoute := inheritRoute(r.template, route.Destination)
+		httpRoute.Match = r.buildMatches(route)
+		httpRoutes = append(httpRoutes, httpRoute)
+	}
+
+	// DefaultはMatchが空
+	fallback := inheritRoute(r.template, service.Name)
+	if r.template != nil && len(r.template.Route) > 0 {
+		// the template routes to the service as it is
+		fallback.Route = r.template.DeepCopy().Route
+	}
+	setMirror(fallback, routes)
+	setCanary(fallback, routes)
+	return append(httpRoutes, fallback)
 }
 
-func (b builder) Build(ctx context.Context) (refresh.Lister, error) {
-	var sortedConfigs []forkv1beta1.VSConfig
-	{
-		configs := &forkv1beta1.VSConfigList{}
-		err := b.r.List(ctx, configs, &client.ListOptions{Namespace: b.serviceSlug.Namespace})
-		if err != nil {
-			return nil, errors.WithStack(err)
+// setMirror shadows requests of the route to the destination of the mirroring route if any
+// Routes other than the fallback are not mirrored since requests with the header are sent to forks already
+// It returns whether the route is changed
+func setMirror(httpRoute *networkingv1beta1.HTTPRoute, routes []Route) bool {
+	for _, route := range routes {
+		if route.Mirror == nil {
+			continue
 		}
-		sort.Slice(configs.Items, func(i, j int) bool { return configs.Items[i].ObjectMeta.Name < configs.Items[j].ObjectMeta.Name })
-		sortedConfigs = configs.Items
+		httpRoute.Mirror = &networkingv1beta1.Destination{Host: route.Destination}
+		httpRoute.MirrorPercentage = &networkingv1beta1.Percent{Value: float64(route.Mirror.Percentage)}
+		return true
 	}
-	service := corev1.Service{}
-	if err := b.r.Get(ctx, b.serviceSlug, &service); err != nil {
-		return nil, errors.WithStack(err)
+	return false
+}
+
+// setCanary sends the weight of the weighted route among requests of the route to its destination
+// Weights of the other destinations are scaled down to fill the rest
+// It returns whether the route is changed
+func setCanary(httpRoute *networkingv1beta1.HTTPRoute, routes []Route) bool {
+	if len(httpRoute.Route) == 0 {
+		return false
 	}
+	for _, route := range routes {
+		if route.Weight == 0 {
+			continue
+		}
+
+		dests := httpRoute.Route
+		weights := make([]int32, len(dests))
+		for i, dest := range dests {
+			weights[i] = dest.Weight
+		}
+		scaled := splitWeights(weights, 100-route.Weight)
+		for i, dest := range dests {
+			dest.Weight = scaled[i]
+		}
 
-	return &vsLister{sortedConfigs: sortedConfigs, service: service}, nil
+		// the port and headers of the first destination are kept as inheritRoute does
+		canary := dests[0].DeepCopy()
+		if canary.Destination == nil {
+			canary.Destination = &networkingv1beta1.Destination{}
+		}
+		canary.Destination.Host = route.Destination
+		canary.Destination.Subset = ""
+		canary.Weight = route.Weight
+		httpRoute.Route = append(dests, canary)
+		return true
+	}
+	return false
 }
 
-func (a vsLister) GenerateLists() []refresh.ObjectList {
-	generators := []func() refresh.ObjectList{
-		a.buildVirtualService,
+// splitWeights scales the weights to sum up to the total, where a single destination without weight takes all
+// The remainder of rounding goes to the first one
+func splitWeights(weights []int32, total int32) []int32 {
+	var sum int32
+	for _, w := range weights {
+		sum += w
 	}
-	res := make([]refresh.ObjectList, len(generators))
-	for i, gen := range generators {
-		res[i] = gen()
+	scaled := make([]int32, len(weights))
+	if sum == 0 {
+		scaled[0] = total
+		return scaled
 	}
-	return res
+
+	rest := total
+	for i, w := range weights {
+		scaled[i] = w * total / sum
+		rest -= scaled[i]
+	}
+	scaled[0] += rest
+	return scaled
 }
 
-func (a vsLister) buildHTTPRoutes() []*networkingv1beta1.HTTPRoute {
-	var routes []*networkingv1beta1.HTTPRoute
-	for _, config := range a.sortedConfigs {
-		if config.Spec.Host != a.service.Name || config.Spec.HeaderValue == "" {
-			continue
+// Merge returns VirtualServices to be updated, the base whose routes of VSConfigs are replaced with the routes
+// and former bases whose routes of VSConfigs are removed
+func (r virtualServiceRenderer) Merge(service corev1.Service, routes []Route) []*istio.VirtualService {
+	var updated []*istio.VirtualService
+	if r.base != nil {
+		if vs := r.merge(r.base, service, routes); vs != nil {
+			updated = append(updated, vs)
 		}
-		routes = append(
-			routes,
-			&networkingv1beta1.HTTPRoute{
-				Match: []*networkingv1beta1.HTTPMatchRequest{
-					{
-						Headers: map[string]*networkingv1beta1.StringMatch{
-							config.Spec.HeaderName: {
-								MatchType: &networkingv1beta1.StringMatch_Exact{
-									Exact: config.Spec.HeaderValue,
-								},
-							},
-						},
-					},
-				},
-				Route: []*networkingv1beta1.HTTPRouteDestination{
-					{
-						Destination: &networkingv1beta1.Destination{
-							Host: config.Spec.Service,
-						},
-					},
-				},
-			},
-		)
-	}
-
-	return append(
-		routes,
-		&networkingv1beta1.HTTPRoute{
-			// DefaultはMatchが空
-			Route: []*networkingv1beta1.HTTPRouteDestination{
-				{
-					Destination: &networkingv1beta1.Destination{
-						Host: a.service.Name,
-					},
-				},
-			},
-		},
-	)
+	}
+	for _, former := range r.formerBases {
+		if vs := r.merge(former, service, nil); vs != nil {
+			updated = append(updated, vs)
+		}
+	}
+	return updated
+}
+
+// merge returns the VirtualService whose routes of VSConfigs are replaced with the routes, or nil when nothing is changed
+// Routes of VSConfigs inherit policies of the first route without conditions, or the last route
+// The VirtualService is labeled while it has routes of VSConfigs so that they are removed once it is no longer the base
+func (r virtualServiceRenderer) merge(base *istio.VirtualService, service corev1.Service, routes []Route) *istio.VirtualService {
+	var kept []*networkingv1beta1.HTTPRoute
+	for _, route := range base.Spec.Http {
+		if !strings.HasPrefix(route.Name, forkRoutePrefix) {
+			kept = append(kept, route)
+		}
+	}
+	var policy *networkingv1beta1.HTTPRoute
+	policyIndex := -1
+	for i, route := range kept {
+		if len(route.Match) == 0 {
+			policy, policyIndex = route, i
+			break
+		}
+	}
+	if policy == nil && len(kept) > 0 {
+		policy, policyIndex = kept[len(kept)-1], len(kept)-1
+	}
+
+	var httpRoutes []*networkingv1beta1.HTTPRoute
+	for _, route := range routes {
+		httpRoute := inheritRoute(policy, route.Destination)
+		httpRoute.Name = forkRoutePrefix + route.Destination
+		httpRoute.Match = r.buildMatches(route)
+		httpRoutes = append(httpRoutes, httpRoute)
+	}
+	for i, route := range kept {
+		// routes of the base are left as they are, so the policy route is mirrored and split by a copy of it placed ahead
+		if i == policyIndex {
+			fallback := route.DeepCopy()
+			fallback.Name = forkRoutePrefix + "fallback"
+			mirrored := setMirror(fallback, routes)
+			if split := setCanary(fallback, routes); mirrored || split {
+				httpRoutes = append(httpRoutes, fallback)
+			}
+		}
+		httpRoutes = append(httpRoutes, route.DeepCopy())
+	}
+
+	merged := base.DeepCopy()
+	merged.Spec.Http = httpRoutes
+	labels := merged.GetLabels()
+	if len(routes) == 0 {
+		delete(labels, labelKeyForVS)
+	} else {
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[labelKeyForVS] = service.Name
+	}
+	merged.SetLabels(labels)
+	if sameSpec(&base.Spec, &merged.Spec) && base.GetLabels()[labelKeyForVS] == labels[labelKeyForVS] {
+		return nil
+	}
+	return merged
+}
+
+// sameSpec compares VirtualServices in JSON since protobuf messages hold internal states
+func sameSpec(a, b *networkingv1beta1.VirtualService) bool {
+	aj, aErr := a.MarshalJSON()
+	bj, bErr := b.MarshalJSON()
+	return aErr == nil && bErr == nil && bytes.Equal(aj, bj)
 }
 
-func (a vsLister) buildVirtualService() refresh.ObjectList {
+func (r virtualServiceRenderer) Render(service corev1.Service, routes []Route) refresh.ObjectList {
 	var list []client.Object
-	if routes := a.buildHTTPRoutes(); len(routes) > 1 {
+	// routes are merged into the base instead, and the owned VirtualService is deleted
+	if httpRoutes := r.buildHTTPRoutes(service, routes); r.baseName == "" && len(httpRoutes) > 1 {
 		vs := istio.VirtualService{
 			TypeMeta: v1.TypeMeta{
 				Kind:       "VirtualService",
 				APIVersion: "networking.istio.io/v1beta1",
 			},
 			ObjectMeta: v1.ObjectMeta{
-				Name:      a.service.Name,
-				Namespace: a.service.Namespace,
+				Name:      r.ResourceName(service),
+				Namespace: service.Namespace,
 				Labels: map[string]string{
-					labelKeyForVS: a.service.Name,
+					labelKeyForVS: service.Name,
 				},
 			},
 			Spec: networkingv1beta1.VirtualService{
-				Hosts: []string{a.service.Name},
-				Http:  routes,
+				Hosts: []string{service.Name},
+				Http:  httpRoutes,
 			},
 		}
 		vs.ObjectMeta.SetResourceVersion(vs.GetResourceVersion())
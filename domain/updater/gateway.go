@@ -0,0 +1,304 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ambassador "github.com/datawire/ambassador/pkg/api/getambassador.io/v2"
+	"github.com/pkg/errors"
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	emissary "github.com/wantedly/kubefork-controller/pkg/api/getambassador.io/v3alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// PreviewGateway generates resources routing preview domains of a ForkManager to its upstreams
+type PreviewGateway interface {
+	// Mapping returns an object routing `<identifier>.<upstream host>` to the upstream for the forks of the identifier
+	// It returns an error when the upstream is not supported by the gateway
+	Mapping(fm *forkv1beta1.ForkManager, upstream forkv1beta1.Upstream, identifier string, forks []forkv1beta1.Fork) (client.Object, error)
+	// Hosts returns objects terminating TLS of preview domains of the upstream for the identifiers
+	Hosts(fm *forkv1beta1.ForkManager, upstream forkv1beta1.Upstream, identifiers []string) []client.Object
+}
+
+// previewGateways holds implementations of each PreviewGateway
+var previewGateways = map[forkv1beta1.PreviewGateway]PreviewGateway{
+	forkv1beta1.PreviewGatewayEmissaryV2:       emissaryV2Gateway{},
+	forkv1beta1.PreviewGatewayEmissaryV3alpha1: emissaryV3alpha1Gateway{},
+	forkv1beta1.PreviewGatewayIngress:          ingressGateway{},
+	forkv1beta1.PreviewGatewayGatewayAPI:       httpRouteGateway{},
+}
+
+// PreviewGatewayOf returns the PreviewGateway selected by the ForkManager
+func PreviewGatewayOf(fm *forkv1beta1.ForkManager) PreviewGateway {
+	if gw, ok := previewGateways[fm.Spec.PreviewGateway]; ok {
+		return gw
+	}
+	return previewGateways[forkv1beta1.PreviewGatewayEmissaryV2]
+}
+
+// PreviewGatewayKinds returns kinds of every resource generated by preview gateways
+// Resources of a kind not selected by a ForkManager are deleted
+func PreviewGatewayKinds() []schema.GroupVersionKind {
+	return []schema.GroupVersionKind{
+		ambassador.GroupVersion.WithKind("Mapping"),
+		emissary.GroupVersion.WithKind("Mapping"),
+		emissary.GroupVersion.WithKind("Host"),
+		networkingv1.SchemeGroupVersion.WithKind("Ingress"),
+		gatewayv1beta1.SchemeGroupVersion.WithKind("HTTPRoute"),
+	}
+}
+
+// mappingName returns the name of resources serving the preview host of the identifier
+// Upstreams without HostTemplate keep names given before templates were introduced
+func mappingName(upstream forkv1beta1.Upstream, identifier string) string {
+	if upstream.HostTemplate == "" {
+		return strings.ReplaceAll(upstream.Host+"-"+identifier, ".", "-")
+	}
+	return nameFromHost(previewHost(upstream, identifier))
+}
+
+// nameFromHost converts a host into a resource name of at most 63 characters
+// A long name is truncated with a hash of the host so that names of different hosts don't collide
+func nameFromHost(host string) string {
+	name := strings.ReplaceAll(strings.ToLower(host), ".", "-")
+	if len(name) <= 63 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(host))
+	return strings.TrimRight(name[:54], "-") + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// previewHost returns the preview host of the identifier, which has been validated before generating resources
+func previewHost(upstream forkv1beta1.Upstream, identifier string) string {
+	host, _ := upstream.PreviewHost(identifier)
+	return host
+}
+
+// upstreamService returns the service and the rewritten host requests are sent with
+func upstreamService(upstream forkv1beta1.Upstream) (service, hostRewrite string) {
+	if upstream.Original == "" {
+		return fmt.Sprintf("https://%s", upstream.Host), ""
+	}
+
+	// if the upstream has original(service name), then we use service name as Host
+	// Priority is described bellow
+	// 1. HostRewrite
+	// 2. Original
+	if upstream.HostRewrite != "" {
+		return upstream.Original, upstream.HostRewrite
+	}
+	return upstream.Original, trimPort(upstream.Original)
+}
+
+// upstreamBackend parses Original of the upstream in the form of `<service>[.<namespace>...][:<port>]`
+// namespace is empty when it is omitted, and port defaults to 80
+func upstreamBackend(upstream forkv1beta1.Upstream) (service, namespace string, port int32, err error) {
+	if upstream.Original == "" || strings.Contains(upstream.Original, "://") {
+		return "", "", 0, errors.Errorf("upstream %s must have original naming a service", upstream.Host)
+	}
+
+	port = 80
+	host := trimPort(upstream.Original)
+	if host != upstream.Original {
+		p, err := strconv.ParseInt(strings.TrimPrefix(upstream.Original, host+":"), 10, 32)
+		if err != nil {
+			return "", "", 0, errors.Wrapf(err, "invalid port of upstream %s", upstream.Host)
+		}
+		port = int32(p)
+	}
+
+	labels := strings.Split(host, ".")
+	service = labels[0]
+	if len(labels) > 1 {
+		namespace = labels[1]
+	}
+	return service, namespace, port, nil
+}
+
+// forwardedHostHeader is added to requests through Emissary unless the upstream gives or removes it
+// see. https://github.com/wantedly/visit-ambassador-v2/pull/105
+const forwardedHostHeader = "x-forwarded-host"
+
+// emissaryRequestHeaders returns headers Emissary adds to requests of the route
+func emissaryRequestHeaders(route previewRoute) map[string]string {
+	headers := map[string]string{}
+	if !sets.NewString(route.removeRequestHeaders...).Has(forwardedHostHeader) {
+		headers[forwardedHostHeader] = "%REQ(:authority)%"
+	}
+	for k, v := range route.addRequestHeaders {
+		headers[k] = v
+	}
+	return headers
+}
+
+// emissaryV2Gateway generates getambassador.io/v2 Mappings
+type emissaryV2Gateway struct{}
+
+func (emissaryV2Gateway) Mapping(fm *forkv1beta1.ForkManager, upstream forkv1beta1.Upstream, identifier string, forks []forkv1beta1.Fork) (client.Object, error) {
+	service, hostRewrite := upstreamService(upstream)
+	route := routeOf(fm, upstream, identifier, forks)
+	mp := &ambassador.Mapping{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      mappingName(upstream, identifier),
+			Namespace: fm.Namespace,
+			Labels: map[string]string{
+				forkv1beta1.ManagerLabelKey:    fm.Name,
+				forkv1beta1.IdentifierLabelKey: identifier,
+			},
+		},
+		Spec: ambassador.MappingSpec{
+			AddRequestHeaders:     map[string]ambassador.AddedHeader{},
+			AllowUpgrade:          route.allowUpgrade,
+			AmbassadorID:          []string{fm.Spec.AmbassadorID},
+			Host:                  previewHost(upstream, identifier),
+			HostRewrite:           hostRewrite,
+			Prefix:                route.prefix,
+			Rewrite:               pointer.StringPtr(route.rewrite),
+			Service:               service,
+			TimeoutMs:             milliseconds(route.timeout),
+			IdleTimeoutMs:         milliseconds(route.idleTimeout),
+			GRPC:                  route.grpc,
+			RemoveRequestHeaders:  route.removeRequestHeaders,
+			RemoveResponseHeaders: route.removeResponseHeaders,
+		},
+	}
+	for k, v := range emissaryRequestHeaders(route) {
+		mp.Spec.AddRequestHeaders[k] = ambassador.AddedHeader{String: pointer.StringPtr(v)}
+	}
+	if len(route.addResponseHeaders) > 0 {
+		mp.Spec.AddResponseHeaders = map[string]ambassador.AddedHeader{}
+		for k, v := range route.addResponseHeaders {
+			mp.Spec.AddResponseHeaders[k] = ambassador.AddedHeader{String: pointer.StringPtr(v)}
+		}
+	}
+	if cors := route.cors; cors != nil {
+		mp.Spec.CORS = &ambassador.CORS{
+			Origins:        cors.Origins,
+			Methods:        cors.Methods,
+			Headers:        cors.Headers,
+			Credentials:    cors.Credentials,
+			ExposedHeaders: cors.ExposedHeaders,
+		}
+		if cors.MaxAge != nil {
+			mp.Spec.CORS.MaxAge = seconds(cors.MaxAge.Duration)
+		}
+	}
+	if retry := route.retryPolicy; retry != nil {
+		mp.Spec.RetryPolicy = &ambassador.RetryPolicy{
+			RetryOn:       retry.RetryOn,
+			NumRetries:    int(retry.NumRetries),
+			PerTryTimeout: envoySeconds(retry.PerTryTimeout),
+		}
+	}
+	return mp, nil
+}
+
+// Hosts returns nothing because TLS of getambassador.io/v2 is configured by hand
+func (emissaryV2Gateway) Hosts(*forkv1beta1.ForkManager, forkv1beta1.Upstream, []string) []client.Object {
+	return nil
+}
+
+// emissaryV3alpha1Gateway generates getambassador.io/v3alpha1 Mappings, and Hosts of upstreams with TLS
+type emissaryV3alpha1Gateway struct{}
+
+func (emissaryV3alpha1Gateway) Mapping(fm *forkv1beta1.ForkManager, upstream forkv1beta1.Upstream, identifier string, forks []forkv1beta1.Fork) (client.Object, error) {
+	service, hostRewrite := upstreamService(upstream)
+	route := routeOf(fm, upstream, identifier, forks)
+	mp := &emissary.Mapping{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      mappingName(upstream, identifier),
+			Namespace: fm.Namespace,
+			Labels: map[string]string{
+				forkv1beta1.ManagerLabelKey:    fm.Name,
+				forkv1beta1.IdentifierLabelKey: identifier,
+			},
+		},
+		Spec: emissary.MappingSpec{
+			AmbassadorID:          []string{fm.Spec.AmbassadorID},
+			Hostname:              previewHost(upstream, identifier),
+			Prefix:                route.prefix,
+			Rewrite:               pointer.StringPtr(route.rewrite),
+			Service:               service,
+			HostRewrite:           hostRewrite,
+			AddRequestHeaders:     map[string]emissary.AddedHeader{},
+			RemoveRequestHeaders:  route.removeRequestHeaders,
+			RemoveResponseHeaders: route.removeResponseHeaders,
+			AllowUpgrade:          route.allowUpgrade,
+			TimeoutMs:             milliseconds(route.timeout),
+			IdleTimeoutMs:         milliseconds(route.idleTimeout),
+			GRPC:                  route.grpc,
+		},
+	}
+	for k, v := range emissaryRequestHeaders(route) {
+		mp.Spec.AddRequestHeaders[k] = emissary.AddedHeader{Value: v}
+	}
+	if len(route.addResponseHeaders) > 0 {
+		mp.Spec.AddResponseHeaders = map[string]emissary.AddedHeader{}
+		for k, v := range route.addResponseHeaders {
+			mp.Spec.AddResponseHeaders[k] = emissary.AddedHeader{Value: v}
+		}
+	}
+	if cors := route.cors; cors != nil {
+		mp.Spec.CORS = &emissary.CORS{
+			Origins:        cors.Origins,
+			Methods:        cors.Methods,
+			Headers:        cors.Headers,
+			Credentials:    cors.Credentials,
+			ExposedHeaders: cors.ExposedHeaders,
+		}
+		if cors.MaxAge != nil {
+			mp.Spec.CORS.MaxAge = seconds(cors.MaxAge.Duration)
+		}
+	}
+	if retry := route.retryPolicy; retry != nil {
+		mp.Spec.RetryPolicy = &emissary.RetryPolicy{
+			RetryOn:       retry.RetryOn,
+			NumRetries:    int(retry.NumRetries),
+			PerTryTimeout: envoySeconds(retry.PerTryTimeout),
+		}
+	}
+	return mp, nil
+}
+
+func (emissaryV3alpha1Gateway) Hosts(fm *forkv1beta1.ForkManager, upstream forkv1beta1.Upstream, identifiers []string) []client.Object {
+	if upstream.TLS == nil {
+		return nil
+	}
+
+	genHost := func(name, hostname string, labels map[string]string) *emissary.Host {
+		return &emissary.Host{
+			ObjectMeta: v1.ObjectMeta{Name: name, Namespace: fm.Namespace, Labels: labels},
+			Spec: emissary.HostSpec{
+				AmbassadorID: []string{fm.Spec.AmbassadorID},
+				Hostname:     hostname,
+				// the certificate is provided by the secret
+				ACMEProvider: &emissary.ACMEProviderSpec{Authority: "none"},
+				TLSSecret:    &emissary.TLSSecretReference{Name: upstream.TLS.SecretName},
+			},
+		}
+	}
+
+	if upstream.TLS.HostMode != forkv1beta1.HostModePerIdentifier {
+		return []client.Object{
+			genHost(nameFromHost("wildcard-"+upstream.Host), upstream.WildcardHost(), map[string]string{forkv1beta1.ManagerLabelKey: fm.Name}),
+		}
+	}
+
+	hosts := make([]client.Object, len(identifiers))
+	for i, identifier := range identifiers {
+		hosts[i] = genHost(mappingName(upstream, identifier), previewHost(upstream, identifier), map[string]string{
+			forkv1beta1.ManagerLabelKey:    fm.Name,
+			forkv1beta1.IdentifierLabelKey: identifier,
+		})
+	}
+	return hosts
+}
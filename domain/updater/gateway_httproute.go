@@ -0,0 +1,114 @@
+package updater
+
+import (
+	"github.com/pkg/errors"
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// httpRouteGateway generates gateway.networking.k8s.io/v1beta1 HTTPRoutes attached to Gateways
+// Services in other namespaces require ReferenceGrants to be routed to
+// Only prefixes, rewrites and request headers of routing options of upstreams are supported
+type httpRouteGateway struct{}
+
+func (httpRouteGateway) Mapping(fm *forkv1beta1.ForkManager, upstream forkv1beta1.Upstream, identifier string, forks []forkv1beta1.Fork) (client.Object, error) {
+	if fm.Spec.GatewayAPI == nil || len(fm.Spec.GatewayAPI.ParentRefs) == 0 {
+		return nil, errors.New("gatewayAPI.parentRefs is required")
+	}
+
+	service, namespace, port, err := upstreamBackend(upstream)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	backend := gatewayv1beta1.BackendObjectReference{
+		Name: gatewayv1beta1.ObjectName(service),
+		Port: (*gatewayv1beta1.PortNumber)(&port),
+	}
+	if namespace != "" && namespace != fm.Namespace {
+		ns := gatewayv1beta1.Namespace(namespace)
+		backend.Namespace = &ns
+	}
+
+	parentRefs := make([]gatewayv1beta1.ParentReference, len(fm.Spec.GatewayAPI.ParentRefs))
+	for i, ref := range fm.Spec.GatewayAPI.ParentRefs {
+		parentRefs[i] = gatewayv1beta1.ParentReference{Name: gatewayv1beta1.ObjectName(ref.Name)}
+		if ref.Namespace != "" {
+			ns := gatewayv1beta1.Namespace(ref.Namespace)
+			parentRefs[i].Namespace = &ns
+		}
+		if ref.SectionName != "" {
+			section := gatewayv1beta1.SectionName(ref.SectionName)
+			parentRefs[i].SectionName = &section
+		}
+	}
+
+	route := routeOf(fm, upstream, identifier, forks)
+	var set []gatewayv1beta1.HTTPHeader
+	for _, k := range sortedKeys(route.addRequestHeaders) {
+		set = append(set, gatewayv1beta1.HTTPHeader{Name: gatewayv1beta1.HTTPHeaderName(k), Value: route.addRequestHeaders[k]})
+	}
+	filters := []gatewayv1beta1.HTTPRouteFilter{
+		{
+			Type:                  gatewayv1beta1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: &gatewayv1beta1.HTTPRequestHeaderFilter{Set: set, Remove: route.removeRequestHeaders},
+		},
+	}
+	rewrite := &gatewayv1beta1.HTTPURLRewriteFilter{}
+	if _, hostRewrite := upstreamService(upstream); hostRewrite != "" {
+		hostname := gatewayv1beta1.PreciseHostname(hostRewrite)
+		rewrite.Hostname = &hostname
+	}
+	if route.rewrite != "" {
+		rewrite.Path = &gatewayv1beta1.HTTPPathModifier{
+			Type:               gatewayv1beta1.PrefixMatchHTTPPathModifier,
+			ReplacePrefixMatch: pointer.StringPtr(route.rewrite),
+		}
+	}
+	if rewrite.Hostname != nil || rewrite.Path != nil {
+		filters = append(filters, gatewayv1beta1.HTTPRouteFilter{
+			Type:       gatewayv1beta1.HTTPRouteFilterURLRewrite,
+			URLRewrite: rewrite,
+		})
+	}
+
+	// ReplacePrefixMatch requires the prefix to be matched explicitly
+	var matches []gatewayv1beta1.HTTPRouteMatch
+	if route.prefix != forkv1beta1.DefaultRoutingPrefix || route.rewrite != "" {
+		pathType := gatewayv1beta1.PathMatchPathPrefix
+		matches = []gatewayv1beta1.HTTPRouteMatch{
+			{Path: &gatewayv1beta1.HTTPPathMatch{Type: &pathType, Value: pointer.StringPtr(route.prefix)}},
+		}
+	}
+
+	return &gatewayv1beta1.HTTPRoute{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      mappingName(upstream, identifier),
+			Namespace: fm.Namespace,
+			Labels: map[string]string{
+				forkv1beta1.ManagerLabelKey:    fm.Name,
+				forkv1beta1.IdentifierLabelKey: identifier,
+			},
+		},
+		Spec: gatewayv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1beta1.CommonRouteSpec{ParentRefs: parentRefs},
+			Hostnames:       []gatewayv1beta1.Hostname{gatewayv1beta1.Hostname(previewHost(upstream, identifier))},
+			Rules: []gatewayv1beta1.HTTPRouteRule{
+				{
+					Matches: matches,
+					Filters: filters,
+					BackendRefs: []gatewayv1beta1.HTTPBackendRef{
+						{BackendRef: gatewayv1beta1.BackendRef{BackendObjectReference: backend}},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// Hosts returns nothing because TLS is terminated by listeners of the Gateways
+func (httpRouteGateway) Hosts(*forkv1beta1.ForkManager, forkv1beta1.Upstream, []string) []client.Object {
+	return nil
+}
@@ -0,0 +1,181 @@
+package updater
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ingress-nginx annotations to add request headers and to rewrite the Host header
+	annotationKeyNginxSnippet      = "nginx.ingress.kubernetes.io/configuration-snippet"
+	annotationKeyNginxUpstreamHost = "nginx.ingress.kubernetes.io/upstream-vhost"
+	annotationKeyNginxReadTimeout  = "nginx.ingress.kubernetes.io/proxy-read-timeout"
+
+	// ingress-nginx annotations to configure routing options of upstreams
+	annotationKeyNginxRegex           = "nginx.ingress.kubernetes.io/use-regex"
+	annotationKeyNginxRewriteTarget   = "nginx.ingress.kubernetes.io/rewrite-target"
+	annotationKeyNginxBackendProtocol = "nginx.ingress.kubernetes.io/backend-protocol"
+	annotationKeyNginxCORS            = "nginx.ingress.kubernetes.io/enable-cors"
+	annotationKeyNginxCORSOrigin      = "nginx.ingress.kubernetes.io/cors-allow-origin"
+	annotationKeyNginxCORSMethods     = "nginx.ingress.kubernetes.io/cors-allow-methods"
+	annotationKeyNginxCORSHeaders     = "nginx.ingress.kubernetes.io/cors-allow-headers"
+	annotationKeyNginxCORSExpose      = "nginx.ingress.kubernetes.io/cors-expose-headers"
+	annotationKeyNginxCORSCredentials = "nginx.ingress.kubernetes.io/cors-allow-credentials"
+	annotationKeyNginxCORSMaxAge      = "nginx.ingress.kubernetes.io/cors-max-age"
+)
+
+// ingressGateway generates networking.k8s.io/v1 Ingresses for ingress-nginx
+// Headers are modified with configuration snippets, which ingress-nginx must allow with `allow-snippet-annotations`
+// Ingresses can only route to Services in the namespace of the ForkManager
+// Idle timeouts and retry policies of upstreams are not supported
+type ingressGateway struct{}
+
+func (ingressGateway) Mapping(fm *forkv1beta1.ForkManager, upstream forkv1beta1.Upstream, identifier string, forks []forkv1beta1.Fork) (client.Object, error) {
+	service, namespace, port, err := upstreamBackend(upstream)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if namespace != "" && namespace != fm.Namespace {
+		return nil, errors.Errorf("upstream %s must have original naming a service in namespace %s", upstream.Host, fm.Namespace)
+	}
+
+	annotations := map[string]string{}
+	var className *string
+	if opts := fm.Spec.Ingress; opts != nil {
+		for k, v := range opts.Annotations {
+			annotations[k] = v
+		}
+		className = opts.ClassName
+	}
+
+	route := routeOf(fm, upstream, identifier, forks)
+	snippet, err := headersSnippet(route)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	annotations[annotationKeyNginxSnippet] = snippet
+	annotations[annotationKeyNginxReadTimeout] = seconds(route.timeout)
+	if _, hostRewrite := upstreamService(upstream); hostRewrite != "" {
+		annotations[annotationKeyNginxUpstreamHost] = hostRewrite
+	}
+	if route.grpc {
+		annotations[annotationKeyNginxBackendProtocol] = "GRPC"
+	}
+	if cors := route.cors; cors != nil {
+		annotations[annotationKeyNginxCORS] = "true"
+		annotations[annotationKeyNginxCORSCredentials] = strconv.FormatBool(cors.Credentials)
+		for k, v := range map[string][]string{
+			annotationKeyNginxCORSOrigin:  cors.Origins,
+			annotationKeyNginxCORSMethods: cors.Methods,
+			annotationKeyNginxCORSHeaders: cors.Headers,
+			annotationKeyNginxCORSExpose:  cors.ExposedHeaders,
+		} {
+			if len(v) > 0 {
+				annotations[k] = strings.Join(v, ", ")
+			}
+		}
+		if cors.MaxAge != nil {
+			annotations[annotationKeyNginxCORSMaxAge] = seconds(cors.MaxAge.Duration)
+		}
+	}
+
+	// ingress-nginx rewrites paths with a regular expression capturing the rest of the prefix
+	path, pathType := route.prefix, networkingv1.PathTypePrefix
+	if route.rewrite != "" {
+		path = strings.TrimSuffix(route.prefix, "/") + "/?(.*)"
+		pathType = networkingv1.PathTypeImplementationSpecific
+		annotations[annotationKeyNginxRegex] = "true"
+		annotations[annotationKeyNginxRewriteTarget] = strings.TrimSuffix(route.rewrite, "/") + "/$1"
+	}
+
+	return &networkingv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      mappingName(upstream, identifier),
+			Namespace: fm.Namespace,
+			Labels: map[string]string{
+				forkv1beta1.ManagerLabelKey:    fm.Name,
+				forkv1beta1.IdentifierLabelKey: identifier,
+			},
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: className,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: previewHost(upstream, identifier),
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     path,
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: service,
+											Port: networkingv1.ServiceBackendPort{Number: port},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// headersSnippet returns a configuration snippet modifying headers of the route
+// Headers which could inject configuration are rejected since nginx has no escape for variables
+// Forks and ForkManagers created before the webhooks checked them may still have such headers
+func headersSnippet(route previewRoute) (string, error) {
+	check := func(name string, values ...string) error {
+		msgs := forkv1beta1.IsHeaderName(name, forkv1beta1.PreviewGatewayIngress)
+		for _, v := range values {
+			msgs = append(msgs, forkv1beta1.IsHeaderValue(v, forkv1beta1.PreviewGatewayIngress)...)
+		}
+		if len(msgs) != 0 {
+			return errors.Errorf("header %q can't be written into %s: %s", name, annotationKeyNginxSnippet, strings.Join(msgs, ", "))
+		}
+		return nil
+	}
+
+	var snippet strings.Builder
+	for _, k := range sortedKeys(route.addRequestHeaders) {
+		if err := check(k, route.addRequestHeaders[k]); err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(&snippet, "proxy_set_header %s \"%s\";\n", k, route.addRequestHeaders[k])
+	}
+	for _, k := range route.removeRequestHeaders {
+		if err := check(k); err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(&snippet, "proxy_set_header %s \"\";\n", k)
+	}
+	for _, k := range sortedKeys(route.addResponseHeaders) {
+		if err := check(k, route.addResponseHeaders[k]); err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(&snippet, "more_set_headers \"%s: %s\";\n", k, route.addResponseHeaders[k])
+	}
+	for _, k := range route.removeResponseHeaders {
+		if err := check(k); err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(&snippet, "more_clear_headers \"%s\";\n", k)
+	}
+	return snippet.String(), nil
+}
+
+// Hosts returns nothing because TLS of Ingresses is configured with annotations
+func (ingressGateway) Hosts(*forkv1beta1.ForkManager, forkv1beta1.Upstream, []string) []client.Object {
+	return nil
+}
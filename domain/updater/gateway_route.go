@@ -0,0 +1,122 @@
+package updater
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// previewRoute is routing options of an upstream resolved for the forks of an identifier
+type previewRoute struct {
+	prefix       string
+	rewrite      string
+	timeout      time.Duration
+	idleTimeout  time.Duration
+	grpc         bool
+	allowUpgrade []string
+	cors         *forkv1beta1.CORSPolicy
+	retryPolicy  *forkv1beta1.RetryPolicy
+
+	addRequestHeaders     map[string]string
+	removeRequestHeaders  []string
+	addResponseHeaders    map[string]string
+	removeResponseHeaders []string
+}
+
+// routeOf resolves routing options of the upstream overridden by GatewayOptions of the forks
+// The header of the fork identifier always wins over headers given by the upstream and the forks
+func routeOf(fm *forkv1beta1.ForkManager, upstream forkv1beta1.Upstream, identifier string, forks []forkv1beta1.Fork) previewRoute {
+	route := previewRoute{
+		prefix:             forkv1beta1.DefaultRoutingPrefix,
+		timeout:            forkv1beta1.DefaultRoutingTimeout,
+		addRequestHeaders:  map[string]string{},
+		addResponseHeaders: map[string]string{},
+	}
+	upgrades := sets.NewString()
+
+	if opts := upstream.Routing; opts != nil {
+		if opts.Prefix != "" {
+			route.prefix = opts.Prefix
+		}
+		route.rewrite = opts.Rewrite
+		if opts.Timeout != nil {
+			route.timeout = opts.Timeout.Duration
+		}
+		if opts.IdleTimeout != nil {
+			route.idleTimeout = opts.IdleTimeout.Duration
+		}
+		route.grpc = opts.GRPC
+		upgrades.Insert(opts.AllowUpgrade...)
+		route.cors = opts.CORS
+		route.retryPolicy = opts.RetryPolicy
+		for k, v := range opts.AddRequestHeaders {
+			route.addRequestHeaders[k] = v
+		}
+		route.removeRequestHeaders = sets.NewString(opts.RemoveRequestHeaders...).List()
+		for k, v := range opts.AddResponseHeaders {
+			route.addResponseHeaders[k] = v
+		}
+		route.removeResponseHeaders = sets.NewString(opts.RemoveResponseHeaders...).List()
+	}
+	if upgrades.Len() == 0 {
+		upgrades.Insert(forkv1beta1.DefaultAllowUpgrade...)
+	}
+
+	// forks sharing the identifier are served by one route, so the longest timeouts are used
+	for _, fork := range forks {
+		opts := fork.Spec.GatewayOptions
+		if opts == nil {
+			continue
+		}
+		for k, v := range opts.AddRequestHeaders {
+			route.addRequestHeaders[k] = v
+		}
+		upgrades.Insert(opts.AllowUpgrade...)
+		for k, v := range opts.AddResponseHeaders {
+			route.addResponseHeaders[k] = v
+		}
+		if opts.Timeout != nil && opts.Timeout.Duration > route.timeout {
+			route.timeout = opts.Timeout.Duration
+		}
+		if opts.IdleTimeout != nil && opts.IdleTimeout.Duration > route.idleTimeout {
+			route.idleTimeout = opts.IdleTimeout.Duration
+		}
+	}
+
+	route.allowUpgrade = upgrades.List()
+	route.addRequestHeaders[fm.Spec.HeaderKey] = identifier
+	return route
+}
+
+// sortedKeys returns keys of the headers in order for less flaky behavior
+func sortedKeys(headers map[string]string) []string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// milliseconds converts the duration into milliseconds
+func milliseconds(d time.Duration) int {
+	return int(d / time.Millisecond)
+}
+
+// seconds converts the duration into seconds, rounding up a fraction
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// envoySeconds formats the duration in seconds as Envoy accepts, e.g. `1.5s`
+func envoySeconds(d *v1.Duration) string {
+	if d == nil {
+		return ""
+	}
+	return strconv.FormatFloat(d.Duration.Seconds(), 'f', -1, 64) + "s"
+}
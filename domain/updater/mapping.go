@@ -3,40 +3,46 @@ package updater
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
-	ambassador "github.com/datawire/ambassador/pkg/api/getambassador.io/v2"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/pkg/refresh"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/utils/pointer"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	util "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-)
-
-const (
-	// Mark ambassador mapping is managed by which ForkManager
-	labelKey = "fork.k8s.wantedly.com/manager"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 type mappingUpdater struct {
 	client client.Client
 	log    logr.Logger
 	scheme *runtime.Scheme
+	clock  clock.PassiveClock
+
+	observers []refresh.Observer
 }
 
 // NewMappingUpdater returns a Updater that reconciles Mapping based on ForkManager
-func NewMappingUpdater(client client.Client, log logr.Logger, scheme *runtime.Scheme) Updater {
+// and reports what the manager serves to the status of ForkManager
+// observers are notified of Mappings created or updated
+func NewMappingUpdater(client client.Client, log logr.Logger, scheme *runtime.Scheme, clock clock.PassiveClock, observers ...refresh.Observer) Updater {
 	return &mappingUpdater{
-		client: client,
-		log:    log,
-		scheme: scheme,
+		client:    client,
+		log:       log,
+		scheme:    scheme,
+		clock:     clock,
+		observers: observers,
 	}
 }
 
@@ -46,96 +52,206 @@ func (r mappingUpdater) Update(ctx context.Context, managerSlug types.Namespaced
 		return errors.WithStack(err)
 	}
 
-	frks := &forkv1beta1.ForkList{}
-	if err := r.client.List(ctx, frks); err != nil {
+	frks, err := ForksOfManager(ctx, r.client, managerSlug)
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	// key:   Mapping name
-	// value: true if should be deleted
-	mappingDeleteCandidate := map[types.NamespacedName]struct{}{}
-	{
-		mps := &ambassador.MappingList{}
-		req, err := labels.NewRequirement(labelKey, selection.Equals, []string{managerSlug.Name})
-		if err != nil {
-			return errors.WithStack(err)
+	gateway := PreviewGatewayOf(fm)
+	// key: kind, namespace and name of objects generated by the gateway
+	desired := sets.String{}
+	// key:   upstream host
+	// value: the first error occurred while updating resources of the upstream
+	upstreamErrs := map[string]error{}
+	fail := func(upstream forkv1beta1.Upstream, err error) {
+		// keep updating other upstreams so that the failure is reported per upstream
+		if _, ok := upstreamErrs[upstream.Host]; !ok {
+			upstreamErrs[upstream.Host] = err
 		}
-		ls := labels.Everything().Add(*req)
-		if err := r.client.List(ctx, mps, &client.ListOptions{LabelSelector: ls}); err != nil {
-			return errors.WithStack(err)
+	}
+	apply := func(upstream forkv1beta1.Upstream, obj client.Object) bool {
+		key, err := r.objectKey(obj)
+		if err == nil {
+			// Reaching here means this object should not be deleted
+			desired.Insert(key)
+			err = refresh.Apply(ctx, r.client, r.scheme, fm, obj, r.observers...)
 		}
-		for _, mp := range mps.Items {
-			mappingDeleteCandidate[types.NamespacedName{Namespace: mp.Namespace, Name: mp.Name}] = struct{}{}
+		if err != nil {
+			fail(upstream, errors.Wrapf(err, "failed to update %s", obj.GetName()))
+			return false
 		}
+		return true
 	}
 
-	forkMap := groupForksByIdentifier(frks.Items)
-	for identifier, forks := range forkMap {
-		for _, upstream := range fm.Spec.Upstreams {
-			key := strings.ReplaceAll(upstream.Host+"-"+identifier, ".", "-")
-			// Reaching here means this mapping should not be deleted
-			delete(mappingDeleteCandidate, types.NamespacedName{Namespace: fm.Namespace, Name: key})
+	// forks violating the policy of the manager are not served
+	var allowed []forkv1beta1.Fork
+	for i := range frks {
+		if len(fm.CheckPolicy(&frks[i], frks, r.clock.Now())) == 0 {
+			allowed = append(allowed, frks[i])
+		}
+	}
 
-			mp := &ambassador.Mapping{ObjectMeta: v1.ObjectMeta{Name: key, Namespace: fm.Namespace}}
+	forkMap := groupForksByIdentifier(allowed)
+	identifiers := sortedIdentifiers(forkMap)
+	var identifierStatuses []forkv1beta1.IdentifierStatus
+	for _, identifier := range identifiers {
+		forks := forkMap[identifier]
+		is := forkv1beta1.IdentifierStatus{Identifier: identifier, Forks: len(forks)}
+		// key: preview host
+		// value: upstream host
+		seenHosts := map[string]string{}
+		for _, upstream := range fm.Spec.Upstreams {
+			host, err := upstream.PreviewHost(identifier)
+			if err != nil {
+				fail(upstream, errors.WithStack(err))
+				continue
+			}
+			if other, ok := seenHosts[host]; ok {
+				fail(upstream, errors.Errorf("preview host %s of upstream %s conflicts with upstream %s", host, upstream.Host, other))
+				continue
+			}
+			seenHosts[host] = upstream.Host
 
-			service := upstream.Original
-			if service == "" {
-				service = fmt.Sprintf("https://%s", upstream.Host)
+			mp, err := gateway.Mapping(fm, upstream, identifier, forks)
+			if err != nil {
+				fail(upstream, errors.WithStack(err))
+				continue
+			}
+			if !apply(upstream, mp) {
+				continue
 			}
+			is.Mappings = append(is.Mappings, mp.GetName())
+			is.Hosts = append(is.Hosts, host)
+		}
+		identifierStatuses = append(identifierStatuses, is)
+	}
+
+	for _, upstream := range fm.Spec.Upstreams {
+		for _, host := range gateway.Hosts(fm, upstream, identifiers) {
+			apply(upstream, host)
+		}
+	}
 
-			if _, err := util.CreateOrUpdate(ctx, r.client, mp, func() error {
-				mp.Spec = ambassador.MappingSpec{
-					AddRequestHeaders: map[string]ambassador.AddedHeader{
-						fm.Spec.HeaderKey: {String: pointer.StringPtr(identifier)},
-
-						// see. https://github.com/wantedly/visit-ambassador-v2/pull/105
-						"x-forwarded-host": {String: pointer.StringPtr("%REQ(:authority)%")},
-					},
-					AllowUpgrade: []string{"websocket"},
-					AmbassadorID: []string{fm.Spec.AmbassadorID},
-					Host:         fmt.Sprintf("%s.%s", identifier, upstream.Host),
-					Prefix:       "/",
-					Rewrite:      pointer.StringPtr(""),
-					Service:      service,
-					TimeoutMs:    90000,
-				}
-
-				// if the upstream has original(service name), then we use service name as Host
-				// Priority is described bellow
-				// 1. HostRewrite
-				// 2. Original
-				if upstream.Original != "" {
-					// if the upstream has HostRewite, then we use it
-					if upstream.HostRewrite != "" {
-						mp.Spec.HostRewrite = upstream.HostRewrite
-					} else {
-						mp.Spec.HostRewrite = trimPort(upstream.Original)
-					}
-				}
-
-				mp.Labels = map[string]string{
-					labelKey: managerSlug.Name,
-				}
-
-				for _, fork := range forks {
-					applyOptionsToMapping(mp, fork)
-				}
-
-				return errors.Wrap(util.SetControllerReference(fm, mp, r.scheme), "failed to set controller reference")
-			}); err != nil {
+	if err := r.deleteOutdated(ctx, managerSlug, desired); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := r.updateStatus(ctx, fm, identifierStatuses, upstreamErrs); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var errs []error
+	for _, upstream := range fm.Spec.Upstreams {
+		if err, ok := upstreamErrs[upstream.Host]; ok {
+			errs = append(errs, err)
+		}
+	}
+	return errors.WithStack(utilerrors.NewAggregate(errs))
+}
+
+// objectKey identifies an object regardless of its version
+// because Emissary serves Mappings of getambassador.io/v2 and v3alpha1 as the same resource
+func (r mappingUpdater) objectKey(obj client.Object) (string, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.scheme)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return fmt.Sprintf("%s/%s/%s", gvk.GroupKind(), obj.GetNamespace(), obj.GetName()), nil
+}
+
+// deleteOutdated deletes resources of preview gateways labeled with the manager in its namespace except for desired ones
+// Managers of the same name in other namespaces label their resources with the same value
+func (r mappingUpdater) deleteOutdated(ctx context.Context, managerSlug types.NamespacedName, desired sets.String) error {
+	for _, gvk := range PreviewGatewayKinds() {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.client.List(ctx, list, client.InNamespace(managerSlug.Namespace), client.MatchingLabels{forkv1beta1.ManagerLabelKey: managerSlug.Name}); err != nil {
+			// nothing has been generated when the kind is not installed
+			if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		for _, item := range list.Items {
+			if desired.Has(fmt.Sprintf("%s/%s/%s", gvk.GroupKind(), item.GetNamespace(), item.GetName())) {
+				continue
+			}
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			obj.SetNamespace(item.GetNamespace())
+			obj.SetName(item.GetName())
+			if err := r.client.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
 				return errors.WithStack(err)
 			}
 		}
 	}
+	return nil
+}
 
-	for mappingName := range mappingDeleteCandidate {
-		mp := &ambassador.Mapping{ObjectMeta: v1.ObjectMeta{Name: mappingName.Name, Namespace: mappingName.Namespace}}
-		if err := r.client.Delete(ctx, mp); err != nil {
-			return errors.WithStack(err)
+func (r mappingUpdater) updateStatus(ctx context.Context, fm *forkv1beta1.ForkManager, identifiers []forkv1beta1.IdentifierStatus, upstreamErrs map[string]error) error {
+	current := fm.Status.DeepCopy()
+
+	// key: upstream host
+	existing := map[string]forkv1beta1.UpstreamStatus{}
+	for _, us := range fm.Status.Upstreams {
+		existing[us.Host] = us
+	}
+
+	// statuses of upstreams removed from spec are dropped here
+	upstreams := make([]forkv1beta1.UpstreamStatus, len(fm.Spec.Upstreams))
+	for i, upstream := range fm.Spec.Upstreams {
+		us := forkv1beta1.UpstreamStatus{Host: upstream.Host, Conditions: existing[upstream.Host].Conditions}
+		cond := v1.Condition{
+			Type:               forkv1beta1.UpstreamConditionMappingsReady,
+			Status:             v1.ConditionTrue,
+			ObservedGeneration: fm.Generation,
+			LastTransitionTime: v1.NewTime(r.clock.Now()),
+			Reason:             "Updated",
+		}
+		if err, ok := upstreamErrs[upstream.Host]; ok {
+			cond.Status = v1.ConditionFalse
+			cond.Reason = "UpdateFailed"
+			cond.Message = err.Error()
 		}
+		meta.SetStatusCondition(&us.Conditions, cond)
+		upstreams[i] = us
 	}
 
-	return nil
+	fm.Status.ObservedGeneration = fm.Generation
+	fm.Status.Identifiers = identifiers
+	fm.Status.Upstreams = upstreams
+
+	// the status is written only when changed, since every fork of the manager triggers this update
+	if equality.Semantic.DeepEqual(current, &fm.Status) {
+		return nil
+	}
+	return errors.WithStack(r.client.Status().Update(ctx, fm))
+}
+
+// ForksOfManager returns Forks referring to the ForkManager
+func ForksOfManager(ctx context.Context, reader client.Reader, managerSlug types.NamespacedName) ([]forkv1beta1.Fork, error) {
+	frks := &forkv1beta1.ForkList{}
+	if err := reader.List(ctx, frks, client.MatchingFields{forkv1beta1.ForkManagerField: managerSlug.String()}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var res []forkv1beta1.Fork
+	for _, f := range frks.Items {
+		if f.Spec.Manager == managerSlug.String() {
+			res = append(res, f)
+		}
+	}
+	return res, nil
+}
+
+func sortedIdentifiers(forkMap map[string][]forkv1beta1.Fork) []string {
+	identifiers := make([]string, 0, len(forkMap))
+	for identifier := range forkMap {
+		identifiers = append(identifiers, identifier)
+	}
+	// for less flaky behavior
+	sort.Strings(identifiers)
+	return identifiers
 }
 
 func groupForksByIdentifier(forks []forkv1beta1.Fork) map[string][]forkv1beta1.Fork {
@@ -149,24 +265,6 @@ func groupForksByIdentifier(forks []forkv1beta1.Fork) map[string][]forkv1beta1.F
 	return res
 }
 
-func applyOptionsToMapping(mp *ambassador.Mapping, fork forkv1beta1.Fork) {
-	if fork.Spec.GatewayOptions != nil {
-		for k, v := range fork.Spec.GatewayOptions.AddRequestHeaders {
-			mp.Spec.AddRequestHeaders[k] = ambassador.AddedHeader{
-				String: pointer.StringPtr(v),
-			}
-
-			{
-				upgradesSet := sets.NewString(mp.Spec.AllowUpgrade...)
-				for _, upgrade := range fork.Spec.GatewayOptions.AllowUpgrade {
-					upgradesSet.Insert(upgrade)
-				}
-				mp.Spec.AllowUpgrade = upgradesSet.List()
-			}
-		}
-	}
-}
-
 func (r mappingUpdater) UpdateAll(ctx context.Context, opts ...client.ListOption) error {
 	list := &forkv1beta1.ForkManagerList{}
 	err := r.client.List(ctx, list, opts...)
@@ -8,17 +8,23 @@ import (
 	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
 	"github.com/wantedly/kubefork-controller/domain/lister"
 	"github.com/wantedly/kubefork-controller/pkg/refresh"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // NewMicroserviceUpdater returns a Updater that reconciles a Microservice (a set of DeploymentCopies and Services)
-func NewMicroserviceUpdater(client client.Client, log logr.Logger, scheme *runtime.Scheme) Updater {
+// A fork violating the policy of its ForkManager, or whose ForkManager is deleted, gets no Microservice
+// observers are notified of resources restored to the desired state
+func NewMicroserviceUpdater(client client.Client, log logr.Logger, scheme *runtime.Scheme, clock clock.PassiveClock, observers ...refresh.Observer) Updater {
 	return &microserviceUpdater{
-		client: client,
-		log:    log,
-		scheme: scheme,
+		client:    client,
+		log:       log,
+		scheme:    scheme,
+		clock:     clock,
+		observers: observers,
 	}
 }
 
@@ -26,6 +32,9 @@ type microserviceUpdater struct {
 	client client.Client
 	log    logr.Logger
 	scheme *runtime.Scheme
+	clock  clock.PassiveClock
+
+	observers []refresh.Observer
 }
 
 func (r microserviceUpdater) Update(ctx context.Context, forkSlug types.NamespacedName) error {
@@ -36,14 +45,25 @@ func (r microserviceUpdater) Update(ctx context.Context, forkSlug types.Namespac
 		return errors.WithStack(client.IgnoreNotFound(err))
 	}
 
-	app, err := lister.NewAppBuilder(r.client, fork).Build(ctx)
-	if err != nil {
+	violations, err := PolicyViolations(ctx, r.client, &fork, r.clock.Now())
+	managerNotFound := apierrors.IsNotFound(err)
+	if err != nil && !managerNotFound {
 		return errors.WithStack(err)
 	}
 
+	var app refresh.Lister
+	if managerNotFound || len(violations) != 0 {
+		app = lister.NewEmptyApp(fork)
+	} else {
+		app, err = lister.NewAppBuilder(r.client, fork, r.clock.Now()).Build(ctx)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
 	resourceLists := app.GenerateLists()
 
-	ref := refresh.New(r.client, r.scheme)
+	ref := refresh.New(r.client, r.scheme, r.observers...)
 	for _, m := range resourceLists {
 		if err := ref.Refresh(ctx, &fork, m); err != nil {
 			return errors.WithStack(err)
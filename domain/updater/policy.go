@@ -0,0 +1,31 @@
+package updater
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PolicyViolations returns the limits of the ForkManager that the fork violates
+func PolicyViolations(ctx context.Context, reader client.Reader, fork *forkv1beta1.Fork, now time.Time) (field.ErrorList, error) {
+	managerSlug, err := forkv1beta1.ParseManager(fork.Spec.Manager)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fm := &forkv1beta1.ForkManager{}
+	if err := reader.Get(ctx, managerSlug, fm); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	forks := &forkv1beta1.ForkList{}
+	if err := reader.List(ctx, forks, client.MatchingFields{forkv1beta1.ForkManagerField: fork.Spec.Manager}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return fm.CheckPolicy(fork, forks.Items, now), nil
+}
@@ -7,14 +7,17 @@ import (
 	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
 	"github.com/wantedly/kubefork-controller/domain/updater"
 	ut "github.com/wantedly/kubefork-controller/pkg/testing"
+	networkingv1beta1 "istio.io/api/networking/v1beta1"
 	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	util "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
 type testcase struct {
@@ -30,6 +33,7 @@ func TestUpdate(t *testing.T) {
 		clientgoscheme.AddToScheme,
 		forkv1beta1.AddToScheme,
 		istio.AddToScheme,
+		gatewayv1beta1.AddToScheme,
 	}
 
 	for _, add := range regs {
@@ -45,6 +49,26 @@ func TestUpdate(t *testing.T) {
 		return child
 	}
 
+	adminRoute := &networkingv1beta1.HTTPRoute{
+		Name:  "admin",
+		Match: []*networkingv1beta1.HTTPMatchRequest{{Uri: &networkingv1beta1.StringMatch{MatchType: &networkingv1beta1.StringMatch_Prefix{Prefix: "/admin"}}}},
+		Route: []*networkingv1beta1.HTTPRouteDestination{{Destination: &networkingv1beta1.Destination{Host: "admin-service"}}},
+	}
+	staleForkRoute := &networkingv1beta1.HTTPRoute{
+		Name:  "kubefork-stale-service",
+		Match: []*networkingv1beta1.HTTPMatchRequest{{Headers: map[string]*networkingv1beta1.StringMatch{"some-header-name": {MatchType: &networkingv1beta1.StringMatch_Exact{Exact: "stale-identifier"}}}}},
+		Route: []*networkingv1beta1.HTTPRouteDestination{{Destination: &networkingv1beta1.Destination{Host: "stale-service"}}},
+	}
+	policyRoute := &networkingv1beta1.HTTPRoute{
+		Name:    "default",
+		Retries: &networkingv1beta1.HTTPRetry{Attempts: 3, RetryOn: "5xx"},
+		Headers: &networkingv1beta1.Headers{Request: &networkingv1beta1.Headers_HeaderOperations{Set: map[string]string{"x-platform": "true"}}},
+		Route: []*networkingv1beta1.HTTPRouteDestination{
+			{Destination: &networkingv1beta1.Destination{Host: "some-service-name", Subset: "v1", Port: &networkingv1beta1.PortSelector{Number: 80}}, Weight: 90},
+			{Destination: &networkingv1beta1.Destination{Host: "some-service-name", Subset: "v2", Port: &networkingv1beta1.PortSelector{Number: 80}}, Weight: 10},
+		},
+	}
+
 	testcases := []testcase{
 		{
 			name:        "only service",
@@ -87,6 +111,160 @@ func TestUpdate(t *testing.T) {
 				ut.GenService("some-service-name"),
 			},
 		},
+		{
+			name:        "conflicting identifier",
+			explanation: "when two vsconfigs route the same header to the same host, only the first one in name order is rendered",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.GenVSConfig("some-service-name", "some-identifier"),
+				ut.SetVSConfigName(ut.GenVSConfig("some-service-name", "some-identifier"), "some-service-name-some-identifier-2"),
+			},
+		},
+		{
+			name:        "gateway api backend",
+			explanation: "when a vsconfig uses Gateway API backend, Updater must reflect it to a HTTPRoute attached to the service",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.SetVSConfigBackend(ut.GenVSConfig("some-service-name", "some-identifier"), forkv1beta1.RoutingBackendGatewayAPI),
+			},
+		},
+		{
+			name:        "switching backend",
+			explanation: "when vsconfigs no longer use Istio backend, the virtual service owned by the service is deleted",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				setOwner(ut.GenService("some-service-name"), ut.GenVS("some-service-name", "some-service-name")),
+				ut.SetVSConfigBackend(ut.GenVSConfig("some-service-name", "some-identifier"), forkv1beta1.RoutingBackendGatewayAPI),
+			},
+		},
+		{
+			name:        "match types",
+			explanation: "vsconfigs match the header by prefix or regex, or the cookie or query parameter as well as the header",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "prefix-identifier"), forkv1beta1.MatchTypePrefix, ""),
+				ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "regex-identifier"), forkv1beta1.MatchTypeRegex, "^(.+,)?{identifier}(,.+)?$"),
+				ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "cookie-identifier"), forkv1beta1.MatchTypeCookie, ""),
+				ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "query-identifier"), forkv1beta1.MatchTypeQueryParam, ""),
+				ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "invalid-identifier"), forkv1beta1.MatchTypeRegex, "^invalid$"),
+			},
+		},
+		{
+			name:        "match types with gateway api backend",
+			explanation: "prefix matches are rendered as regular expressions in a HTTPRoute",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.SetVSConfigBackend(ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "prefix-identifier"), forkv1beta1.MatchTypePrefix, ""), forkv1beta1.RoutingBackendGatewayAPI),
+				ut.SetVSConfigBackend(ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "cookie-identifier"), forkv1beta1.MatchTypeCookie, ""), forkv1beta1.RoutingBackendGatewayAPI),
+				ut.SetVSConfigBackend(ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "query-identifier"), forkv1beta1.MatchTypeQueryParam, ""), forkv1beta1.RoutingBackendGatewayAPI),
+			},
+		},
+		{
+			name:        "match types with names",
+			explanation: "the cookie or query parameter of the name is matched as well as the header",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.SetVSConfigMatchName(ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "cookie-identifier"), forkv1beta1.MatchTypeCookie, ""), "fork"),
+				ut.SetVSConfigMatchName(ut.SetVSConfigMatch(ut.GenVSConfig("some-service-name", "query-identifier"), forkv1beta1.MatchTypeQueryParam, ""), "fork"),
+			},
+		},
+		{
+			name:        "scoped vsconfigs",
+			explanation: "vsconfigs route only requests in the scope of the uri, methods and port as well as the header",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.SetVSConfigScope(ut.GenVSConfig("some-service-name", "prefix-identifier"), forkv1beta1.RouteScope{URIPrefix: "/api/", Methods: []string{"GET"}, Port: pointer.Int32(8080)}),
+				ut.SetVSConfigScope(ut.GenVSConfig("some-service-name", "regex-identifier"), forkv1beta1.RouteScope{URIRegex: "^/users/[0-9]+$", Methods: []string{"GET", "POST"}}),
+			},
+		},
+		{
+			name:        "scoped vsconfigs with gateway api backend",
+			explanation: "a match is rendered for each method, and vsconfigs scoped by port are not rendered",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.SetVSConfigBackend(ut.SetVSConfigScope(ut.GenVSConfig("some-service-name", "regex-identifier"), forkv1beta1.RouteScope{URIRegex: "^/users/[0-9]+$", Methods: []string{"GET", "POST"}}), forkv1beta1.RoutingBackendGatewayAPI),
+				ut.SetVSConfigBackend(ut.SetVSConfigScope(ut.GenVSConfig("some-service-name", "port-identifier"), forkv1beta1.RouteScope{Port: pointer.Int32(8080)}), forkv1beta1.RoutingBackendGatewayAPI),
+			},
+		},
+		{
+			name:        "mirroring vsconfig",
+			explanation: "requests without the header are mirrored to the first mirroring vsconfig, and the others are not rendered",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.SetVSConfigMirror(ut.GenVSConfig("some-service-name", "mirroring-identifier"), 10),
+				ut.SetVSConfigMirror(ut.GenVSConfig("some-service-name", "other-identifier"), 20),
+				ut.SetVSConfigBackend(ut.SetVSConfigMirror(ut.GenVSConfig("some-service-name", "unsupported-identifier"), 30), forkv1beta1.RoutingBackendGatewayAPI),
+			},
+		},
+		{
+			name:        "mirroring vsconfig with base virtual service",
+			explanation: "a copy of the default route of the base mirrors requests, and the other routes of the base are kept",
+			initialState: []client.Object{
+				ut.GenService("some-service-name", ut.AddSVCAnnotation(forkv1beta1.BaseVirtualServiceAnnotationKey, "base-virtual-service")),
+				ut.SetVSHTTPRoutes(ut.GenVS("base-virtual-service", "some-service-name"), adminRoute, policyRoute),
+				ut.SetVSConfigMirror(ut.GenVSConfig("some-service-name", "some-identifier"), 10),
+			},
+		},
+		{
+			name:        "canary vsconfig",
+			explanation: "the weight of requests without the header is sent to the first weighted vsconfig along with the policies of the template, and the others are not rendered",
+			initialState: []client.Object{
+				ut.GenService("some-service-name", ut.AddSVCAnnotation(forkv1beta1.RouteTemplateAnnotationKey, `{"route":[{"destination":{"host":"some-service-name","subset":"v1"},"weight":90},{"destination":{"host":"some-service-name","subset":"v2"},"weight":10}]}`)),
+				ut.SetVSConfigWeight(ut.GenVSConfig("some-service-name", "canary-identifier"), 25),
+				ut.SetVSConfigWeight(ut.GenVSConfig("some-service-name", "other-identifier"), 50),
+			},
+		},
+		{
+			name:        "canary vsconfig with gateway api backend",
+			explanation: "the default rule of the HTTPRoute is split by weights of backends",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.SetVSConfigBackend(ut.SetVSConfigWeight(ut.GenVSConfig("some-service-name", "canary-identifier"), 25), forkv1beta1.RoutingBackendGatewayAPI),
+			},
+		},
+		{
+			name:        "canary vsconfig with base virtual service",
+			explanation: "a copy of the default route of the base is split and mirrors requests, and the other routes of the base are kept",
+			initialState: []client.Object{
+				ut.GenService("some-service-name", ut.AddSVCAnnotation(forkv1beta1.BaseVirtualServiceAnnotationKey, "base-virtual-service")),
+				ut.SetVSHTTPRoutes(ut.GenVS("base-virtual-service", "some-service-name"), adminRoute, policyRoute),
+				ut.SetVSConfigMirror(ut.SetVSConfigWeight(ut.GenVSConfig("some-service-name", "some-identifier"), 25), 10),
+			},
+		},
+		{
+			name:        "base virtual service",
+			explanation: "routes of vsconfigs inheriting the policies of the default route are merged into the base, and the other routes of the base are kept",
+			initialState: []client.Object{
+				ut.GenService("some-service-name", ut.AddSVCAnnotation(forkv1beta1.BaseVirtualServiceAnnotationKey, "base-virtual-service")),
+				ut.SetVSHTTPRoutes(ut.GenVS("base-virtual-service", "some-service-name"), adminRoute, staleForkRoute, policyRoute),
+				ut.GenVSConfig("some-service-name", "some-identifier"),
+			},
+		},
+		{
+			name:        "missing base virtual service",
+			explanation: "vsconfigs are not rendered when the base is missing, and no virtual service is owned by the service",
+			initialState: []client.Object{
+				ut.GenService("some-service-name", ut.AddSVCAnnotation(forkv1beta1.BaseVirtualServiceAnnotationKey, "base-virtual-service")),
+				ut.GenVSConfig("some-service-name", "some-identifier"),
+			},
+		},
+		{
+			name:        "former base virtual service",
+			explanation: "routes of vsconfigs are removed from a virtual service which is no longer the base",
+			initialState: []client.Object{
+				ut.GenService("some-service-name"),
+				ut.AddVSLabel(ut.SetVSHTTPRoutes(ut.GenVS("base-virtual-service", "some-service-name"), staleForkRoute, policyRoute), "fork.k8s.wantedly.com/service", "some-service-name"),
+				ut.GenVSConfig("some-service-name", "some-identifier"),
+			},
+		},
+		{
+			name:        "route template",
+			explanation: "routes of the owned virtual service inherit the policies of the template",
+			initialState: []client.Object{
+				ut.GenService("some-service-name", ut.AddSVCAnnotation(forkv1beta1.RouteTemplateAnnotationKey, `{"retries":{"attempts":3,"retryOn":"5xx"},"route":[{"destination":{"host":"some-service-name","subset":"v1"}}]}`)),
+				ut.GenVSConfig("some-service-name", "some-identifier"),
+			},
+		},
 		{
 			name:        "empty identifier",
 			explanation: `When the headerValue is empty, match will evaluate based on whether or not a header is attached. This test case ensure that updates doesn't create virtual service with empty identifier`,
@@ -133,7 +311,15 @@ func TestUpdate(t *testing.T) {
 						if err := fakeClient.List(ctx, vsl, &client.ListOptions{Namespace: "some-namespace"}); err != nil {
 							t.Fatal(err)
 						}
-						ut.SnapshotYaml(t, vsl)
+						hrl := &gatewayv1beta1.HTTPRouteList{}
+						if err := fakeClient.List(ctx, hrl, &client.ListOptions{Namespace: "some-namespace"}); err != nil {
+							t.Fatal(err)
+						}
+						vscl := &forkv1beta1.VSConfigList{}
+						if err := fakeClient.List(ctx, vscl, &client.ListOptions{Namespace: "some-namespace"}); err != nil {
+							t.Fatal(err)
+						}
+						ut.SnapshotYaml(t, vsl, hrl, vscl)
 					}
 				})
 			}
@@ -207,11 +393,9 @@ func TestUpdateAll(t *testing.T) {
 			},
 		},
 		{
-			// TODO: this should create virtual service
 			name:        "with empty vsconfig",
-			explanation: "When virtual service (`some-random-service` in this case) is missing it does nothing to the vs",
+			explanation: "When the host service (`some-random-service` in this case) is missing it does nothing to the vs and reports it on the vsconfig",
 			initialState: []client.Object{
-				ut.GenService("some-random-service"), // TODO: without this, UpdateAll returns an error
 				ut.GenVSConfig("some-random-service", "some-random-identifire"),
 			},
 		},
@@ -239,7 +423,11 @@ func TestUpdateAll(t *testing.T) {
 						if err := fakeClient.List(ctx, vsl, &client.ListOptions{Namespace: "some-namespace"}); err != nil {
 							t.Fatal(err)
 						}
-						ut.SnapshotYaml(t, vsl)
+						vscl := &forkv1beta1.VSConfigList{}
+						if err := fakeClient.List(ctx, vscl, &client.ListOptions{Namespace: "some-namespace"}); err != nil {
+							t.Fatal(err)
+						}
+						ut.SnapshotYaml(t, vsl, vscl)
 					}
 				})
 			}
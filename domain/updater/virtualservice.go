@@ -2,29 +2,45 @@ package updater
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
 	"github.com/wantedly/kubefork-controller/domain/lister"
 	"github.com/wantedly/kubefork-controller/pkg/refresh"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type virtualServiceUpdater struct {
-	client client.Client
-	log    logr.Logger
-	scheme *runtime.Scheme
+	client         client.Client
+	log            logr.Logger
+	scheme         *runtime.Scheme
+	defaultBackend forkv1beta1.RoutingBackend
 }
 
 // NewVirtualServiceUpdater returns a Updater that reconciles VirtualService based on Service
 func NewVirtualServiceUpdater(client client.Client, log logr.Logger, scheme *runtime.Scheme) Updater {
+	return NewRoutingUpdater(client, log, scheme, forkv1beta1.RoutingBackendIstio)
+}
+
+// NewRoutingUpdater returns a Updater that reconciles routing resources of the backends based on Service
+// VSConfigs without backend are rendered with defaultBackend
+func NewRoutingUpdater(client client.Client, log logr.Logger, scheme *runtime.Scheme, defaultBackend forkv1beta1.RoutingBackend) Updater {
+	if defaultBackend == "" {
+		defaultBackend = forkv1beta1.RoutingBackendIstio
+	}
 	return &virtualServiceUpdater{
-		client: client,
-		log:    log,
-		scheme: scheme,
+		client:         client,
+		log:            log,
+		scheme:         scheme,
+		defaultBackend: defaultBackend,
 	}
 }
 
@@ -32,10 +48,13 @@ func (r virtualServiceUpdater) Update(ctx context.Context, serviceSlug types.Nam
 	// service is the top of the reference tree
 	service := &corev1.Service{}
 	if err := r.client.Get(ctx, serviceSlug, service); err != nil {
-		// TODO: update status of vsconfig not to process them multiple times
+		if apierrors.IsNotFound(err) {
+			// VirtualServices are garbage collected with the service, so only VSConfigs are left to be reported
+			return errors.WithStack(r.reportMissingHost(ctx, serviceSlug))
+		}
 		return errors.WithStack(err)
 	}
-	lstr, err := lister.NewVirtualServiceBuilder(r.client, serviceSlug).Build(ctx)
+	lstr, err := lister.NewRoutingBuilder(r.client, serviceSlug, r.defaultBackend).Build(ctx)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -47,20 +66,83 @@ func (r virtualServiceUpdater) Update(ctx context.Context, serviceSlug types.Nam
 		}
 	}
 
+	// base VirtualServices are owned by users, so they are only updated
+	if merger, ok := lstr.(lister.VirtualServiceMerger); ok {
+		for _, vs := range merger.MergedVirtualServices() {
+			if err := r.client.Update(ctx, vs); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	if reporter, ok := lstr.(lister.VSConfigReporter); ok {
+		for _, config := range reporter.OutdatedVSConfigs() {
+			config := config
+			if err := r.client.Status().Update(ctx, &config); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
 	return nil
 }
 
+// reportMissingHost marks VSConfigs targeting a missing Service as not rendered
+func (r virtualServiceUpdater) reportMissingHost(ctx context.Context, serviceSlug types.NamespacedName) error {
+	configs := &forkv1beta1.VSConfigList{}
+	if err := r.client.List(ctx, configs, client.InNamespace(serviceSlug.Namespace), client.MatchingFields{forkv1beta1.VSConfigHostField: serviceSlug.Name}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, config := range configs.Items {
+		if config.Spec.Host != serviceSlug.Name {
+			continue
+		}
+		st := forkv1beta1.VSConfigStatus{
+			ObservedGeneration: config.Generation,
+			Reason:             forkv1beta1.VSConfigReasonHostNotFound,
+			Message:            fmt.Sprintf("Service %s is not found", serviceSlug.Name),
+		}
+		if equality.Semantic.DeepEqual(config.Status, st) {
+			continue
+		}
+		config := config
+		config.Status = st
+		if err := r.client.Status().Update(ctx, &config); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateAll updates VirtualServices of Services and reports VSConfigs whose Service is missing
+// A failure on a Service doesn't stop updating the others
 func (r virtualServiceUpdater) UpdateAll(ctx context.Context, opts ...client.ListOption) error {
 	services := &corev1.ServiceList{}
 	err := r.client.List(ctx, services, opts...)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	configs := &forkv1beta1.VSConfigList{}
+	if err := r.client.List(ctx, configs, opts...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	slugs := map[types.NamespacedName]struct{}{}
 	for _, service := range services.Items {
-		err := r.Update(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace})
-		if err != nil {
-			return errors.WithStack(err)
+		slugs[types.NamespacedName{Name: service.Name, Namespace: service.Namespace}] = struct{}{}
+	}
+	for _, config := range configs.Items {
+		// Update reports the missing host
+		slugs[types.NamespacedName{Name: config.Spec.Host, Namespace: config.Namespace}] = struct{}{}
+	}
+
+	var errs []error
+	for slug := range slugs {
+		if err := r.Update(ctx, slug); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to update virtual service of %s", slug))
 		}
 	}
-	return nil
+	return errors.WithStack(utilerrors.NewAggregate(errs))
 }
@@ -2,7 +2,11 @@ package client
 
 import (
 	"context"
+	"time"
 
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -11,4 +15,17 @@ type Client interface {
 	GetAllDeploymentLabelsByDeploymentName(ctx context.Context, namespace, deploymentName string) (map[string]string, error)
 	GetAllContainersByImageNameAndServiceAndDeploymentSelector(ctx context.Context, namespace, imageName string,
 		serviceSelector, deploymentSelector *metav1.LabelSelector) ([]string, error)
+	ListForks(ctx context.Context, namespace string) ([]v1beta1.Fork, error)
+	ListForksByIdentifier(ctx context.Context, namespace, identifier string) ([]v1beta1.Fork, error)
+	GetForkManager(ctx context.Context, namespace, name string) (*v1beta1.ForkManager, error)
+	UpdateForkDeadline(ctx context.Context, namespace, name string, deadline time.Time) error
+	GetFork(ctx context.Context, namespace, name string) (*v1beta1.Fork, error)
+	ApplyFork(ctx context.Context, fork *v1beta1.Fork) error
+	GetVSConfig(ctx context.Context, namespace, name string) (*v1beta1.VSConfig, error)
+	GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error)
+	ListPods(ctx context.Context, namespace string, selector *metav1.LabelSelector) ([]v1.Pod, error)
+	DeleteFork(ctx context.Context, namespace, name string) error
+	// ListLabeledResources lists Services, Deployments, DeploymentCopies, VSConfigs and Mappings labeled with the identifier
+	ListLabeledResources(ctx context.Context, namespace, identifier string) ([]v1beta1.ForkResource, error)
+	DeleteResource(ctx context.Context, resource v1beta1.ForkResource) error
 }
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/client"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/domain"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type applyOption struct {
+	manifestOption
+	wait    bool
+	timeout time.Duration
+}
+
+type applyCmdRunner struct {
+	option *applyOption
+	// createOnly makes the command fail when the Fork already exists
+	createOnly bool
+}
+
+func NewCreateCmd() *cobra.Command {
+	return newApplyCmd("create", "Create a Fork resource in the cluster", true)
+}
+
+func NewApplyCmd() *cobra.Command {
+	return newApplyCmd("apply", "Create or update a Fork resource in the cluster", false)
+}
+
+func newApplyCmd(use, short string, createOnly bool) *cobra.Command {
+	opt := &applyOption{}
+
+	runner := applyCmdRunner{
+		option:     opt,
+		createOnly: createOnly,
+	}
+
+	cmd := &cobra.Command{
+		Use:   use,
+		RunE:  runner.applyRun,
+		Short: short,
+		Long: short + ` with server-side apply.
+The Fork is built from the same options as the manifest command.
+With --wait, this command waits until the forked Deployments are available and Mappings are created,
+then prints the preview URLs of the upstreams of the ForkManager.
+`,
+	}
+
+	addForkFlags(cmd, &opt.manifestOption)
+	cmd.Flags().BoolVarP(&opt.wait, "wait", "w", false, "wait until the Fork becomes ready")
+	cmd.Flags().DurationVar(&opt.timeout, "timeout", 10*time.Minute, "how long to wait for the Fork to become ready")
+
+	return cmd
+}
+
+func (a applyCmdRunner) applyRun(cmd *cobra.Command, _ []string) error {
+	f, cli, err := buildFork(cmd, &a.option.manifestOption)
+	if err != nil {
+		return err
+	}
+	frk := f.Object()
+
+	if a.createOnly {
+		if _, err := cli.GetFork(cmd.Context(), frk.Namespace, frk.Name); err == nil {
+			return errors.Errorf("Fork %s/%s already exists", frk.Namespace, frk.Name)
+		} else if !apierrors.IsNotFound(errors.Cause(err)) {
+			return err
+		}
+	}
+
+	if err := cli.ApplyFork(cmd.Context(), frk); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "fork.fork.k8s.wantedly.com/%s applied\n", frk.Name)
+
+	if !a.option.wait {
+		return nil
+	}
+
+	if err := waitForkReady(cmd, cli, frk.Namespace, frk.Name, a.option.timeout); err != nil {
+		return err
+	}
+
+	slug, err := v1beta1.ParseManager(frk.Spec.Manager)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fm, err := cli.GetForkManager(cmd.Context(), slug.Namespace, slug.Name)
+	if err != nil {
+		return err
+	}
+	for _, url := range domain.PreviewURLs(frk.Spec.Identifier, fm) {
+		fmt.Fprintln(cmd.OutOrStdout(), url)
+	}
+
+	return nil
+}
+
+// waitForkReady polls the Fork until its phase becomes Ready
+func waitForkReady(cmd *cobra.Command, cli client.Client, namespace, name string, timeout time.Duration) error {
+	var phase v1beta1.ForkPhase
+	err := wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+		f, err := cli.GetFork(cmd.Context(), namespace, name)
+		if err != nil {
+			return false, err
+		}
+		// status of the previous generation may be left just after apply
+		if f.Status.ObservedGeneration != f.Generation {
+			return false, nil
+		}
+		phase = f.Status.Phase
+		if phase == v1beta1.ForkPhaseDegraded {
+			return false, errors.Errorf("Fork %s/%s is degraded, see `kubectl describe fork -n %s %s`", namespace, name, namespace, name)
+		}
+		return phase == v1beta1.ForkPhaseReady, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return errors.Errorf("timed out waiting for Fork %s/%s to be ready (phase: %s)", namespace, name, phase)
+	}
+	return errors.WithStack(err)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/client"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/k8sClientGo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type deleteOption struct {
+	namespace      string
+	dryRun         bool
+	force          bool
+	timeout        time.Duration
+	kubeConfigPath string
+}
+
+type deleteCmdRunner struct {
+	option *deleteOption
+}
+
+func NewDeleteCmd() *cobra.Command {
+	opt := &deleteOption{}
+
+	runner := deleteCmdRunner{
+		option: opt,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "delete <identifier>",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runner.deleteRun,
+		Short: "Delete a virtual cluster",
+		Long: `Delete all Forks with the identifier and wait until the generated resources are garbage collected.
+Resources labeled with fork.k8s.wantedly.com/identifier=<identifier> which are left after that are reported,
+and removed as well with --force.
+Forks in all namespaces are deleted unless --namespace is specified.
+`,
+	}
+
+	cmd.Flags().StringVarP(&opt.namespace, "namespace", "n", "", "target namespace")
+	cmd.Flags().BoolVar(&opt.dryRun, "dry-run", false, "only show what would be removed")
+	cmd.Flags().BoolVar(&opt.force, "force", false, "remove resources left after garbage collection")
+	cmd.Flags().DurationVar(&opt.timeout, "timeout", 2*time.Minute, "how long to wait for garbage collection")
+	cmd.Flags().StringVarP(&opt.kubeConfigPath, "kubeconfig", "k", os.Getenv("KUBECONFIG"), "path of kubeconig\n(loading order follows the same rule as kubectl)")
+
+	return cmd
+}
+
+func (d deleteCmdRunner) deleteRun(cmd *cobra.Command, args []string) error {
+	cli, err := k8sClientGo.NewClientSet(d.option.kubeConfigPath, cmd.Flags().Changed("kubeconfig"))
+	if err != nil {
+		return err
+	}
+	identifier := args[0]
+	out := cmd.OutOrStdout()
+
+	forks, err := cli.ListForksByIdentifier(cmd.Context(), d.option.namespace, identifier)
+	if err != nil {
+		return err
+	}
+
+	if d.option.dryRun {
+		resources, err := cli.ListLabeledResources(cmd.Context(), d.option.namespace, identifier)
+		if err != nil {
+			return err
+		}
+		for _, f := range forks {
+			fmt.Fprintf(out, "Fork %s/%s would be deleted\n", f.Namespace, f.Name)
+		}
+		for _, r := range resources {
+			fmt.Fprintf(out, "%s %s/%s would be removed\n", r.Kind, r.Namespace, r.Name)
+		}
+		return nil
+	}
+
+	for _, f := range forks {
+		if err := cli.DeleteFork(cmd.Context(), f.Namespace, f.Name); err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+			return err
+		}
+		fmt.Fprintf(out, "Fork %s/%s deleted\n", f.Namespace, f.Name)
+	}
+
+	left, err := waitGarbageCollected(cmd, cli, d.option.namespace, identifier, d.option.timeout)
+	if err != nil {
+		return err
+	}
+	if len(left) == 0 {
+		return nil
+	}
+
+	if !d.option.force {
+		for _, r := range left {
+			fmt.Fprintf(out, "%s %s/%s is left\n", r.Kind, r.Namespace, r.Name)
+		}
+		return errors.Errorf("%d resources are left, run with --force to remove them", len(left))
+	}
+	for _, r := range left {
+		if err := cli.DeleteResource(cmd.Context(), r); err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+			return err
+		}
+		fmt.Fprintf(out, "%s %s/%s removed\n", r.Kind, r.Namespace, r.Name)
+	}
+
+	return nil
+}
+
+// waitGarbageCollected waits until the Forks and resources labeled with the identifier are removed
+// It returns the labeled resources left after the timeout.
+func waitGarbageCollected(cmd *cobra.Command, cli client.Client, namespace, identifier string, timeout time.Duration) ([]v1beta1.ForkResource, error) {
+	var left []v1beta1.ForkResource
+	err := wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+		forks, err := cli.ListForksByIdentifier(cmd.Context(), namespace, identifier)
+		if err != nil {
+			return false, err
+		}
+		left, err = cli.ListLabeledResources(cmd.Context(), namespace, identifier)
+		if err != nil {
+			return false, err
+		}
+		return len(forks) == 0 && len(left) == 0, nil
+	})
+	if err != nil && !errors.Is(err, wait.ErrWaitTimeout) {
+		return nil, errors.WithStack(err)
+	}
+	return left, nil
+}
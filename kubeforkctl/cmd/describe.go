@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/client"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/domain"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/k8sClientGo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+type describeCmdRunner struct {
+	option *listOption
+}
+
+func NewDescribeCmd() *cobra.Command {
+	opt := &listOption{}
+
+	runner := describeCmdRunner{
+		option: opt,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "describe <identifier>",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runner.describeRun,
+		Short: "Show resources generated for a virtual cluster",
+		Long: `Show Forks with the identifier and resources generated for them.
+Fork -> DeploymentCopy -> Deployment -> Pods, Services, VSConfig -> VirtualService route and Mappings are shown.
+`,
+	}
+
+	addListFlags(cmd, opt)
+
+	return cmd
+}
+
+func (d describeCmdRunner) describeRun(cmd *cobra.Command, args []string) error {
+	cli, err := k8sClientGo.NewClientSet(d.option.kubeConfigPath, cmd.Flags().Changed("kubeconfig"))
+	if err != nil {
+		return err
+	}
+
+	forks, err := cli.ListForksByIdentifier(cmd.Context(), d.option.namespace, args[0])
+	if err != nil {
+		return err
+	}
+	if len(forks) == 0 {
+		return errors.Errorf("no Fork with identifier %s is found", args[0])
+	}
+	managers, err := getForkManagers(cmd, cli, forks)
+	if err != nil {
+		return err
+	}
+
+	var trees []domain.ForkTree
+	for _, vc := range domain.NewVirtualClusters(forks, managers) {
+		for _, fs := range vc.Forks {
+			for _, f := range forks {
+				if f.Namespace != fs.Namespace || f.Name != fs.Name {
+					continue
+				}
+				tree, err := buildForkTree(cmd, cli, f, fs, managers[f.Spec.Manager])
+				if err != nil {
+					return err
+				}
+				trees = append(trees, tree)
+			}
+		}
+	}
+
+	return printOutput(cmd.OutOrStdout(), d.option.output, trees, func(w io.Writer) {
+		for _, t := range trees {
+			printForkTree(w, t, time.Now())
+		}
+	})
+}
+
+func buildForkTree(cmd *cobra.Command, cli client.Client, f v1beta1.Fork, fs domain.ForkSummary, fm *v1beta1.ForkManager) (domain.ForkTree, error) {
+	tree := domain.ForkTree{ForkSummary: fs, Services: fs.Services}
+
+	// key: Mapping name
+	// value: preview host
+	mappingHosts := map[string]string{}
+	if fm != nil {
+		for _, is := range fm.Status.Identifiers {
+			if is.Identifier != f.Spec.Identifier {
+				continue
+			}
+			for i, name := range is.Mappings {
+				if i < len(is.Hosts) {
+					mappingHosts[name] = is.Hosts[i]
+				}
+			}
+		}
+	}
+
+	for _, r := range f.Status.Resources {
+		switch r.Kind {
+		case "DeploymentCopy":
+			node := domain.DeploymentCopyNode{Name: r.Name}
+			// deployment-duplicator names the copied Deployment after the DeploymentCopy
+			dply, err := cli.GetDeployment(cmd.Context(), r.Namespace, r.Name)
+			if err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+				return tree, err
+			}
+			if err == nil {
+				dn := &domain.DeploymentNode{Name: dply.Name, Replicas: 1, AvailableReplicas: dply.Status.AvailableReplicas}
+				if dply.Spec.Replicas != nil {
+					dn.Replicas = *dply.Spec.Replicas
+				}
+				pods, err := cli.ListPods(cmd.Context(), dply.Namespace, dply.Spec.Selector)
+				if err != nil {
+					return tree, err
+				}
+				for _, p := range pods {
+					dn.Pods = append(dn.Pods, domain.PodNode{Name: p.Name, Phase: string(p.Status.Phase)})
+				}
+				node.Deployment = dn
+			}
+			tree.DeploymentCopies = append(tree.DeploymentCopies, node)
+		case "VSConfig":
+			vsc, err := cli.GetVSConfig(cmd.Context(), r.Namespace, r.Name)
+			if err != nil {
+				if apierrors.IsNotFound(errors.Cause(err)) {
+					continue
+				}
+				return tree, err
+			}
+			tree.VSConfigs = append(tree.VSConfigs, domain.VSConfigNode{
+				Name:           vsc.Name,
+				Host:           vsc.Spec.Host,
+				Rendered:       vsc.Status.Rendered,
+				VirtualService: vsc.Status.VirtualService,
+				RouteIndex:     vsc.Status.RouteIndex,
+				Reason:         string(vsc.Status.Reason),
+			})
+		case "Mapping":
+			tree.Mappings = append(tree.Mappings, domain.MappingNode{Namespace: r.Namespace, Name: r.Name, Host: mappingHosts[r.Name]})
+		}
+	}
+
+	return tree, nil
+}
+
+func printForkTree(w io.Writer, t domain.ForkTree, now time.Time) {
+	deadline := "<none>"
+	if t.Deadline != nil {
+		deadline = fmt.Sprintf("%s (%s left)", t.Deadline.Local().Format(time.RFC3339), duration.HumanDuration(domain.Remaining(t.Deadline, now)))
+	}
+	fmt.Fprintf(w, "Fork %s/%s\n", t.Namespace, t.Name)
+	fmt.Fprintf(w, "  Manager:\t%s\n", t.Manager)
+	fmt.Fprintf(w, "  Phase:\t%s\n", t.Phase)
+	fmt.Fprintf(w, "  Deadline:\t%s\n", deadline)
+
+	for _, dc := range t.DeploymentCopies {
+		fmt.Fprintf(w, "  DeploymentCopy %s\n", dc.Name)
+		if dc.Deployment == nil {
+			fmt.Fprintln(w, "    Deployment <not created yet>")
+			continue
+		}
+		fmt.Fprintf(w, "    Deployment %s\t%d/%d available\n", dc.Deployment.Name, dc.Deployment.AvailableReplicas, dc.Deployment.Replicas)
+		for _, p := range dc.Deployment.Pods {
+			fmt.Fprintf(w, "      Pod %s\t%s\n", p.Name, p.Phase)
+		}
+	}
+	for _, svc := range t.Services {
+		fmt.Fprintf(w, "  Service %s\n", svc)
+	}
+	for _, vsc := range t.VSConfigs {
+		fmt.Fprintf(w, "  VSConfig %s\thost: %s\n", vsc.Name, vsc.Host)
+		if vsc.Rendered && vsc.RouteIndex != nil {
+			fmt.Fprintf(w, "    VirtualService %s\troute #%d\n", vsc.VirtualService, *vsc.RouteIndex)
+		} else {
+			fmt.Fprintf(w, "    VirtualService <not rendered: %s>\n", vsc.Reason)
+		}
+	}
+	for _, mp := range t.Mappings {
+		fmt.Fprintf(w, "  Mapping %s/%s\t%s\n", mp.Namespace, mp.Name, mp.Host)
+	}
+	fmt.Fprintln(w)
+}
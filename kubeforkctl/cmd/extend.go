@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/client"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/domain"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/k8sClientGo"
+)
+
+type extendOption struct {
+	namespace      string
+	by             time.Duration
+	kubeConfigPath string
+}
+
+type extendCmdRunner struct {
+	option *extendOption
+}
+
+func NewExtendCmd() *cobra.Command {
+	opt := &extendOption{}
+
+	runner := extendCmdRunner{
+		option: opt,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "extend <identifier>",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runner.extendRun,
+		Short: "Extend the deadline of Forks",
+		Long: `Extend the deadline of every Fork with the identifier.
+The deadline will not exceed the maxLifetime of the ForkManager from now.
+`,
+	}
+
+	cmd.Flags().StringVarP(&opt.namespace, "namespace", "n", "", "target namespace")
+	cmd.Flags().DurationVar(&opt.by, "by", 4*time.Hour, "duration to extend the deadline by")
+	cmd.Flags().StringVarP(&opt.kubeConfigPath, "kubeconfig", "k", os.Getenv("KUBECONFIG"), "path of kubeconig\n(loading order follows the same rule as kubectl)")
+
+	return cmd
+}
+
+func (e extendCmdRunner) extendRun(cmd *cobra.Command, args []string) error {
+	cli, err := k8sClientGo.NewClientSet(e.option.kubeConfigPath, cmd.Flags().Changed("kubeconfig"))
+	if err != nil {
+		return err
+	}
+
+	return updateDeadlines(cmd, cli, e.option.namespace, args[0], func(f v1beta1.Fork, fm *v1beta1.ForkManager, now time.Time) (time.Time, bool) {
+		return domain.ExtendDeadline(f.Spec.Deadline, e.option.by, now, maxLifetime(fm))
+	})
+}
+
+// updateDeadlines patches the deadline of every Fork with the identifier to the one returned by newDeadline
+func updateDeadlines(cmd *cobra.Command, cli client.Client, namespace, identifier string,
+	newDeadline func(f v1beta1.Fork, fm *v1beta1.ForkManager, now time.Time) (time.Time, bool)) error {
+	forks, err := cli.ListForksByIdentifier(cmd.Context(), namespace, identifier)
+	if err != nil {
+		return err
+	}
+	if len(forks) == 0 {
+		return errors.Errorf("no Fork with identifier %s is found in namespace %s", identifier, namespace)
+	}
+
+	// key: <namespace>/<name> of ForkManager
+	managers := map[string]*v1beta1.ForkManager{}
+	for _, f := range forks {
+		fm, ok := managers[f.Spec.Manager]
+		if !ok {
+			slug, err := v1beta1.ParseManager(f.Spec.Manager)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if fm, err = cli.GetForkManager(cmd.Context(), slug.Namespace, slug.Name); err != nil {
+				return err
+			}
+			managers[f.Spec.Manager] = fm
+		}
+
+		deadline, capped := newDeadline(f, fm, time.Now())
+		if err := cli.UpdateForkDeadline(cmd.Context(), f.Namespace, f.Name, deadline); err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("%s/%s: deadline is %s", f.Namespace, f.Name, deadline.Local().Format(time.RFC3339))
+		if capped {
+			msg += fmt.Sprintf(" (capped by maxLifetime of ForkManager %s)", f.Spec.Manager)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), msg)
+	}
+
+	return nil
+}
+
+func maxLifetime(fm *v1beta1.ForkManager) *time.Duration {
+	if fm.Spec.MaxLifetime == nil {
+		return nil
+	}
+	return &fm.Spec.MaxLifetime.Duration
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/domain"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/k8sClientGo"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+type listOption struct {
+	namespace      string
+	output         string
+	kubeConfigPath string
+}
+
+type listCmdRunner struct {
+	option *listOption
+}
+
+func NewListCmd() *cobra.Command {
+	opt := &listOption{}
+
+	runner := listCmdRunner{
+		option: opt,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Args:  cobra.NoArgs,
+		RunE:  runner.listRun,
+		Short: "List virtual clusters",
+		Long: `List Forks grouped by identifier.
+Forks in all namespaces are listed unless --namespace is specified.
+`,
+	}
+
+	addListFlags(cmd, opt)
+
+	return cmd
+}
+
+func NewGetCmd() *cobra.Command {
+	opt := &listOption{}
+
+	runner := listCmdRunner{
+		option: opt,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "get <identifier>",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runner.listRun,
+		Short: "Show a virtual cluster",
+		Long: `Show Forks with the identifier.
+Forks in all namespaces are shown unless --namespace is specified.
+`,
+	}
+
+	addListFlags(cmd, opt)
+
+	return cmd
+}
+
+func addListFlags(cmd *cobra.Command, opt *listOption) {
+	cmd.Flags().StringVarP(&opt.namespace, "namespace", "n", "", "target namespace")
+	addOutputFlag(cmd, &opt.output)
+	cmd.Flags().StringVarP(&opt.kubeConfigPath, "kubeconfig", "k", os.Getenv("KUBECONFIG"), "path of kubeconig\n(loading order follows the same rule as kubectl)")
+}
+
+func (l listCmdRunner) listRun(cmd *cobra.Command, args []string) error {
+	cli, err := k8sClientGo.NewClientSet(l.option.kubeConfigPath, cmd.Flags().Changed("kubeconfig"))
+	if err != nil {
+		return err
+	}
+
+	forks, err := cli.ListForks(cmd.Context(), l.option.namespace)
+	if err != nil {
+		return err
+	}
+	managers, err := getForkManagers(cmd, cli, forks)
+	if err != nil {
+		return err
+	}
+	clusters := domain.NewVirtualClusters(forks, managers)
+
+	// get command
+	if len(args) == 1 {
+		var found []domain.VirtualCluster
+		for _, vc := range clusters {
+			if vc.Identifier == args[0] {
+				found = append(found, vc)
+			}
+		}
+		if len(found) == 0 {
+			return errors.Errorf("no Fork with identifier %s is found", args[0])
+		}
+		clusters = found
+	}
+
+	return printOutput(cmd.OutOrStdout(), l.option.output, clusters, func(w io.Writer) {
+		printVirtualClusters(w, clusters, time.Now())
+	})
+}
+
+func printVirtualClusters(w io.Writer, clusters []domain.VirtualCluster, now time.Time) {
+	fmt.Fprintln(w, "IDENTIFIER\tNAMESPACE\tNAME\tMANAGER\tPHASE\tDEADLINE\tREMAINING\tSERVICES\tHOSTS")
+	for _, vc := range clusters {
+		for i, f := range vc.Forks {
+			identifier := ""
+			// the identifier is shown only at the first row of a group
+			if i == 0 {
+				identifier = vc.Identifier
+			}
+			deadline, remaining := "<none>", "<none>"
+			if f.Deadline != nil {
+				deadline = f.Deadline.Local().Format(time.RFC3339)
+				remaining = duration.HumanDuration(domain.Remaining(f.Deadline, now))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", identifier, f.Namespace, f.Name, f.Manager, f.Phase,
+				deadline, remaining, joinOrNone(f.Services), joinOrNone(f.Hosts))
+		}
+	}
+}
+
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return "<none>"
+	}
+	return strings.Join(items, ",")
+}
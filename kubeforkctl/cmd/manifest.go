@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/client"
 	"github.com/wantedly/kubefork-controller/kubeforkctl/domain"
 	"github.com/wantedly/kubefork-controller/kubeforkctl/k8sClientGo"
 )
@@ -48,9 +49,29 @@ Deployment-duplicator create forked Deployment from DeploymentCopy.
 `,
 	}
 
+	cmd.Flags().StringVarP(&opt.outputPath, "output", "o", "", "the path output fork manifest to file in the path specified by this option instead of standard output")
+	addForkFlags(cmd, opt)
+
+	return cmd
+}
+
+func (m manifestCmdRunner) manifestRun(cmd *cobra.Command, _ []string) error {
+	f, _, err := buildFork(cmd, m.option)
+	if err != nil {
+		return err
+	}
+
+	if err := f.OutputManifest(m.option.outputPath); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addForkFlags adds flags to build a Fork, which are shared by the commands generating a Fork
+func addForkFlags(cmd *cobra.Command, opt *manifestOption) {
 	cmd.Flags().StringVarP(&opt.identifier, "identifier", "i", "", "unique identifier for the forked resources")
 	cmd.Flags().StringVarP(&opt.namespace, "namespace", "n", "", "target namespace")
-	cmd.Flags().StringVarP(&opt.outputPath, "output", "o", "", "the path output fork manifest to file in the path specified by this option instead of standard output")
 	cmd.Flags().Int32VarP(&opt.replicaNum, "replicas", "r", 1, "set replicas on deployment")
 	cmd.Flags().StringArrayVar(&opt.serviceLabel, "service-label", []string{}, "label of service to be forked\n(support '<key>', '!<key>' '<key>=<value>' or '<key>!=<value>' formats)")
 	cmd.Flags().StringVar(&opt.serviceName, "service-name", "", "name of service to be forked")
@@ -62,62 +83,57 @@ Deployment-duplicator create forked Deployment from DeploymentCopy.
 	cmd.Flags().StringVarP(&opt.forkManagerName, "fork-manager", "f", "", "name of fork manager\n(support '<namespace>/<name>' format)")
 	cmd.Flags().Int64VarP(&opt.validTime, "valid-time", "v", 8, "valid time of fork resource (hour)")
 	cmd.Flags().StringVarP(&opt.kubeConfigPath, "kubeconfig", "k", os.Getenv("KUBECONFIG"), "path of kubeconig\n(loading order follows the same rule as kubectl)")
-
-	return cmd
 }
 
-func (m manifestCmdRunner) manifestRun(cmd *cobra.Command, _ []string) error {
+// buildFork builds a Fork from the options, looking up services and deployments in the cluster
+func buildFork(cmd *cobra.Command, opt *manifestOption) (domain.Fork, client.Client, error) {
 	// Select client
-	cli, err := k8sClientGo.NewClientSet(m.option.kubeConfigPath, cmd.Flags().Changed("kubeconfig"))
+	cli, err := k8sClientGo.NewClientSet(opt.kubeConfigPath, cmd.Flags().Changed("kubeconfig"))
 	if err != nil {
-		return err
+		return domain.Fork{}, nil, err
 	}
 
 	// Generate service selector
 	serviceLabels := map[string]string{}
 	if cmd.Flags().Changed("service-name") {
-		serviceLabels, err = cli.GetAllServiceLabelsByServiceName(cmd.Context(), m.option.namespace, m.option.serviceName)
+		serviceLabels, err = cli.GetAllServiceLabelsByServiceName(cmd.Context(), opt.namespace, opt.serviceName)
 		if err != nil {
-			return err
+			return domain.Fork{}, nil, err
 		}
 	}
 
-	serviceSelector, err := domain.NewSelector(m.option.serviceLabel, serviceLabels)
+	serviceSelector, err := domain.NewSelector(opt.serviceLabel, serviceLabels)
 	if err != nil {
-		return err
+		return domain.Fork{}, nil, err
 	}
 
 	// Generate deployment selector
 	deploymentLabels := map[string]string{}
 	if cmd.Flags().Changed("deployment-name") {
-		deploymentLabels, err = cli.GetAllDeploymentLabelsByDeploymentName(cmd.Context(), m.option.namespace, m.option.deploymentName)
+		deploymentLabels, err = cli.GetAllDeploymentLabelsByDeploymentName(cmd.Context(), opt.namespace, opt.deploymentName)
 		if err != nil {
-			return err
+			return domain.Fork{}, nil, err
 		}
 	}
 
-	deploymentSelector, err := domain.NewSelector(m.option.deploymentLabel, deploymentLabels)
+	deploymentSelector, err := domain.NewSelector(opt.deploymentLabel, deploymentLabels)
 	if err != nil {
-		return err
+		return domain.Fork{}, nil, err
 	}
 
 	// The specified environment variables is overwritten in all containers where the image is switched
-	env := domain.NewEnv(m.option.identifier, m.option.env)
+	env := domain.NewEnv(opt.identifier, opt.env)
 
 	// Extract the containers whose images should be switched and create a manifest that changes the images in those containers
-	containerNames, err := cli.GetAllContainersByImageNameAndServiceAndDeploymentSelector(cmd.Context(), m.option.namespace,
-		m.option.image, serviceSelector, deploymentSelector)
+	containerNames, err := cli.GetAllContainersByImageNameAndServiceAndDeploymentSelector(cmd.Context(), opt.namespace,
+		opt.image, serviceSelector, deploymentSelector)
 	if err != nil {
-		return err
+		return domain.Fork{}, nil, err
 	}
-	containers := domain.NewContainers(m.option.image, containerNames, env)
+	containers := domain.NewContainers(opt.image, containerNames, env)
 
-	f := domain.NewFork(m.option.identifier, m.option.namespace, m.option.forkManagerName, m.option.replicaNum, time.Duration(m.option.validTime), serviceSelector, deploymentSelector,
-		containers, m.option.deploymentAnnotation)
+	f := domain.NewFork(opt.identifier, opt.namespace, opt.forkManagerName, opt.replicaNum, time.Duration(opt.validTime), serviceSelector, deploymentSelector,
+		containers, opt.deploymentAnnotation)
 
-	if err := f.OutputManifest(m.option.outputPath); err != nil {
-		return err
-	}
-
-	return nil
+	return f, cli, nil
 }
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/client"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// addOutputFlag adds the flag to choose the output format among table, json and yaml
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", "table", "output format\n(support 'table', 'json' or 'yaml')")
+}
+
+// printOutput writes obj in the format, table is used to write it as a table
+func printOutput(w io.Writer, format string, obj interface{}, table func(w io.Writer)) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		table(tw)
+		return errors.WithStack(tw.Flush())
+	case "json":
+		b, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return errors.WithStack(err)
+	case "yaml":
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = w.Write(b)
+		return errors.WithStack(err)
+	default:
+		return errors.Errorf("unsupported output format %q", format)
+	}
+}
+
+// getForkManagers returns ForkManagers referred by the Forks, keyed by `<namespace>/<name>`
+// ForkManagers which don't exist are omitted.
+func getForkManagers(cmd *cobra.Command, cli client.Client, forks []v1beta1.Fork) (map[string]*v1beta1.ForkManager, error) {
+	managers := map[string]*v1beta1.ForkManager{}
+	for _, f := range forks {
+		if _, ok := managers[f.Spec.Manager]; ok {
+			continue
+		}
+		slug, err := v1beta1.ParseManager(f.Spec.Manager)
+		if err != nil {
+			continue
+		}
+		fm, err := cli.GetForkManager(cmd.Context(), slug.Namespace, slug.Name)
+		if err != nil {
+			if apierrors.IsNotFound(errors.Cause(err)) {
+				continue
+			}
+			return nil, err
+		}
+		managers[f.Spec.Manager] = fm
+	}
+	return managers, nil
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/domain"
+	"github.com/wantedly/kubefork-controller/kubeforkctl/k8sClientGo"
+)
+
+type renewOption struct {
+	namespace      string
+	kubeConfigPath string
+}
+
+type renewCmdRunner struct {
+	option *renewOption
+}
+
+func NewRenewCmd() *cobra.Command {
+	opt := &renewOption{}
+
+	runner := renewCmdRunner{
+		option: opt,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "renew <identifier>",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runner.renewRun,
+		Short: "Reset the deadline of Forks as if they were created now",
+		Long: `Reset the deadline of every Fork with the identifier to the lifetime of the ForkManager from now.
+The lifetime is maxLifetime of the ForkManager, or 8h when it is not specified.
+`,
+	}
+
+	cmd.Flags().StringVarP(&opt.namespace, "namespace", "n", "", "target namespace")
+	cmd.Flags().StringVarP(&opt.kubeConfigPath, "kubeconfig", "k", os.Getenv("KUBECONFIG"), "path of kubeconig\n(loading order follows the same rule as kubectl)")
+
+	return cmd
+}
+
+func (r renewCmdRunner) renewRun(cmd *cobra.Command, args []string) error {
+	cli, err := k8sClientGo.NewClientSet(r.option.kubeConfigPath, cmd.Flags().Changed("kubeconfig"))
+	if err != nil {
+		return err
+	}
+
+	return updateDeadlines(cmd, cli, r.option.namespace, args[0], func(_ v1beta1.Fork, fm *v1beta1.ForkManager, now time.Time) (time.Time, bool) {
+		return domain.RenewDeadline(fm.Spec.Lifetime(), now, maxLifetime(fm))
+	})
+}
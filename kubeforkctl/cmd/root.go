@@ -32,6 +32,14 @@ func subcommands() []*cobra.Command {
 	subCmd := []*cobra.Command{
 		// add subcommands below
 		NewManifestCmd(),
+		NewCreateCmd(),
+		NewApplyCmd(),
+		NewListCmd(),
+		NewGetCmd(),
+		NewDescribeCmd(),
+		NewDeleteCmd(),
+		NewExtendCmd(),
+		NewRenewCmd(),
 	}
 
 	return subCmd
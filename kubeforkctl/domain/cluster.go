@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VirtualCluster is a set of Forks sharing an identifier
+type VirtualCluster struct {
+	Identifier string        `json:"identifier"`
+	Forks      []ForkSummary `json:"forks"`
+}
+
+// ForkSummary describes a Fork in a VirtualCluster
+type ForkSummary struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Manager   string            `json:"manager"`
+	Phase     v1beta1.ForkPhase `json:"phase,omitempty"`
+	Deadline  *metav1.Time      `json:"deadline,omitempty"`
+	// Services is a list of names of Services forked
+	Services []string `json:"services,omitempty"`
+	// Hosts is a list of preview hosts served by the ForkManager
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// NewVirtualClusters groups Forks by identifier
+// managers is keyed by `<namespace>/<name>` and used to look up preview hosts, a missing manager is ignored.
+func NewVirtualClusters(forks []v1beta1.Fork, managers map[string]*v1beta1.ForkManager) []VirtualCluster {
+	// key: identifier
+	clusters := map[string]*VirtualCluster{}
+	for _, f := range forks {
+		vc, ok := clusters[f.Spec.Identifier]
+		if !ok {
+			vc = &VirtualCluster{Identifier: f.Spec.Identifier}
+			clusters[f.Spec.Identifier] = vc
+		}
+
+		fs := ForkSummary{
+			Namespace: f.Namespace,
+			Name:      f.Name,
+			Manager:   f.Spec.Manager,
+			Phase:     f.Status.Phase,
+			Deadline:  f.Spec.Deadline,
+		}
+		for _, r := range f.Status.Resources {
+			if r.Kind == "Service" {
+				fs.Services = append(fs.Services, r.Name)
+			}
+		}
+		if fm, ok := managers[f.Spec.Manager]; ok {
+			for _, is := range fm.Status.Identifiers {
+				if is.Identifier == f.Spec.Identifier {
+					fs.Hosts = is.Hosts
+				}
+			}
+		}
+		vc.Forks = append(vc.Forks, fs)
+	}
+
+	res := make([]VirtualCluster, 0, len(clusters))
+	for _, vc := range clusters {
+		sort.Slice(vc.Forks, func(i, j int) bool {
+			if vc.Forks[i].Namespace != vc.Forks[j].Namespace {
+				return vc.Forks[i].Namespace < vc.Forks[j].Namespace
+			}
+			return vc.Forks[i].Name < vc.Forks[j].Name
+		})
+		res = append(res, *vc)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Identifier < res[j].Identifier })
+
+	return res
+}
+
+// Deadline returns the earliest deadline of the Forks, nil when none of them has a deadline
+func (vc VirtualCluster) Deadline() *metav1.Time {
+	var earliest *metav1.Time
+	for _, f := range vc.Forks {
+		if f.Deadline != nil && (earliest == nil || f.Deadline.Before(earliest)) {
+			earliest = f.Deadline
+		}
+	}
+	return earliest
+}
+
+// Remaining returns time left until the deadline, which is zero when the deadline has passed
+func Remaining(deadline *metav1.Time, now time.Time) time.Duration {
+	if deadline == nil || deadline.Time.Before(now) {
+		return 0
+	}
+	return deadline.Time.Sub(now)
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewVirtualClusters(t *testing.T) {
+	genFork := func(namespace, name, identifier string, resources ...v1beta1.ForkResource) v1beta1.Fork {
+		return v1beta1.Fork{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       v1beta1.ForkSpec{Manager: "ambassador/default", Identifier: identifier},
+			Status:     v1beta1.ForkStatus{Phase: v1beta1.ForkPhaseReady, Resources: resources},
+		}
+	}
+	managers := map[string]*v1beta1.ForkManager{
+		"ambassador/default": {
+			Status: v1beta1.ForkManagerStatus{
+				Identifiers: []v1beta1.IdentifierStatus{
+					{Identifier: "foo", Hosts: []string{"foo.sandbox.example.com"}},
+				},
+			},
+		},
+	}
+
+	got := NewVirtualClusters([]v1beta1.Fork{
+		genFork("ns-b", "kubefork-foo", "foo", v1beta1.ForkResource{Kind: "Service", Name: "svc-foo"}, v1beta1.ForkResource{Kind: "Mapping", Name: "m"}),
+		genFork("ns-a", "kubefork-foo", "foo"),
+		genFork("ns-a", "kubefork-bar", "bar"),
+	}, managers)
+
+	want := []VirtualCluster{
+		{
+			Identifier: "bar",
+			Forks: []ForkSummary{
+				{Namespace: "ns-a", Name: "kubefork-bar", Manager: "ambassador/default", Phase: v1beta1.ForkPhaseReady},
+			},
+		},
+		{
+			Identifier: "foo",
+			Forks: []ForkSummary{
+				{Namespace: "ns-a", Name: "kubefork-foo", Manager: "ambassador/default", Phase: v1beta1.ForkPhaseReady, Hosts: []string{"foo.sandbox.example.com"}},
+				{Namespace: "ns-b", Name: "kubefork-foo", Manager: "ambassador/default", Phase: v1beta1.ForkPhaseReady, Services: []string{"svc-foo"}, Hosts: []string{"foo.sandbox.example.com"}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("NewVirtualClusters() mismatch (-want +got):\n%s", diff)
+	}
+}
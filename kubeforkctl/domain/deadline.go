@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExtendDeadline returns the deadline moved later by `by`
+// A Fork without deadline is extended from now. When maxLifetime is not nil, the result is capped at now + maxLifetime
+// and the second return value becomes true.
+func ExtendDeadline(current *metav1.Time, by time.Duration, now time.Time, maxLifetime *time.Duration) (time.Time, bool) {
+	base := now
+	if current != nil && current.Time.After(now) {
+		base = current.Time
+	}
+	return capDeadline(base.Add(by), now, maxLifetime)
+}
+
+// RenewDeadline returns the deadline of a Fork created now
+func RenewDeadline(lifetime time.Duration, now time.Time, maxLifetime *time.Duration) (time.Time, bool) {
+	return capDeadline(now.Add(lifetime), now, maxLifetime)
+}
+
+func capDeadline(deadline, now time.Time, maxLifetime *time.Duration) (time.Time, bool) {
+	if maxLifetime != nil && deadline.After(now.Add(*maxLifetime)) {
+		return now.Add(*maxLifetime), true
+	}
+	return deadline, false
+}
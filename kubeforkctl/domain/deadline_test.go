@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExtendDeadline(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	hours := func(h int) *time.Duration {
+		d := time.Duration(h) * time.Hour
+		return &d
+	}
+	at := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(d))
+		return &t
+	}
+
+	tests := []struct {
+		name        string
+		current     *metav1.Time
+		maxLifetime *time.Duration
+		want        time.Time
+		wantCapped  bool
+	}{
+		{
+			name:    "[Normal] extends the current deadline",
+			current: at(time.Hour),
+			want:    now.Add(5 * time.Hour),
+		},
+		{
+			name:    "[Normal] extends from now when the deadline has passed",
+			current: at(-time.Hour),
+			want:    now.Add(4 * time.Hour),
+		},
+		{
+			name: "[Normal] extends from now when there is no deadline",
+			want: now.Add(4 * time.Hour),
+		},
+		{
+			name:        "[Normal] capped by the max lifetime",
+			current:     at(3 * time.Hour),
+			maxLifetime: hours(6),
+			want:        now.Add(6 * time.Hour),
+			wantCapped:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, capped := ExtendDeadline(tt.current, 4*time.Hour, now, tt.maxLifetime)
+			if !got.Equal(tt.want) || capped != tt.wantCapped {
+				t.Errorf("ExtendDeadline() = (%v, %v), want (%v, %v)", got, capped, tt.want, tt.wantCapped)
+			}
+		})
+	}
+}
@@ -27,7 +27,7 @@ func NewFork(identifier, namespace, forkManagerName string, replicaNum int32, va
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "kubefork-" + identifier,
 			Namespace: namespace,
-			Labels:    map[string]string{"fork.k8s.wantedly.com/identifier": identifier},
+			Labels:    map[string]string{v1beta1.IdentifierLabelKey: identifier},
 		},
 		Spec: v1beta1.ForkSpec{
 			Manager:    forkManagerName,
@@ -58,6 +58,11 @@ func NewFork(identifier, namespace, forkManagerName string, replicaNum int32, va
 	return Fork{&fork}
 }
 
+// Object returns the Fork resource
+func (f Fork) Object() *v1beta1.Fork {
+	return f.f
+}
+
 func (f Fork) OutputManifest(path string) error {
 	y, err := yaml.Marshal(*(f.f))
 	if err != nil {
@@ -76,6 +81,20 @@ func (f Fork) OutputManifest(path string) error {
 	return nil
 }
 
+// PreviewURLs returns URLs to access upstreams of the ForkManager through the fork
+// Upstreams whose preview hosts are invalid are skipped because they are not served
+func PreviewURLs(identifier string, fm *v1beta1.ForkManager) []string {
+	var urls []string
+	for _, u := range fm.Spec.Upstreams {
+		host, err := u.PreviewHost(identifier)
+		if err != nil {
+			continue
+		}
+		urls = append(urls, "https://"+host)
+	}
+	return urls
+}
+
 // Auxiliary functions to create Fork
 
 func NewSelector(labelFromOption []string, labelFromName map[string]string) (*metav1.LabelSelector, error) {
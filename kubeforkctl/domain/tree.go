@@ -0,0 +1,47 @@
+package domain
+
+// ForkTree is a Fork and the resources generated for it
+type ForkTree struct {
+	ForkSummary      `json:",inline"`
+	DeploymentCopies []DeploymentCopyNode `json:"deploymentCopies,omitempty"`
+	Services         []string             `json:"services,omitempty"`
+	VSConfigs        []VSConfigNode       `json:"vsConfigs,omitempty"`
+	Mappings         []MappingNode        `json:"mappings,omitempty"`
+}
+
+// DeploymentCopyNode is a DeploymentCopy and the Deployment copied by deployment-duplicator
+type DeploymentCopyNode struct {
+	Name       string          `json:"name"`
+	Deployment *DeploymentNode `json:"deployment,omitempty"`
+}
+
+// DeploymentNode is a copied Deployment and its Pods
+type DeploymentNode struct {
+	Name              string    `json:"name"`
+	Replicas          int32     `json:"replicas"`
+	AvailableReplicas int32     `json:"availableReplicas"`
+	Pods              []PodNode `json:"pods,omitempty"`
+}
+
+// PodNode is a Pod of a copied Deployment
+type PodNode struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+}
+
+// VSConfigNode is a VSConfig and the route rendered from it
+type VSConfigNode struct {
+	Name           string `json:"name"`
+	Host           string `json:"host"`
+	Rendered       bool   `json:"rendered"`
+	VirtualService string `json:"virtualService,omitempty"`
+	RouteIndex     *int32 `json:"routeIndex,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// MappingNode is a Mapping serving the identifier
+type MappingNode struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Host      string `json:"host,omitempty"`
+}
@@ -2,14 +2,23 @@ package k8sClientGo
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/wantedly/kubefork-controller/api/v1beta1"
 	"github.com/wantedly/kubefork-controller/kubeforkctl/client"
 	"github.com/wantedly/kubefork-controller/kubeforkctl/lib"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -17,7 +26,36 @@ import (
 // Implementation of client by k8s.io/client-go
 
 type k8sClientGo struct {
-	clientSet *kubernetes.Clientset
+	clientSet     *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+}
+
+// fieldManager is the name of the field manager used for server-side apply
+const fieldManager = "kubeforkctl"
+
+var (
+	forkResource        = v1beta1.GroupVersion.WithResource("forks")
+	forkManagerResource = v1beta1.GroupVersion.WithResource("forkmanagers")
+	vsConfigResource    = v1beta1.GroupVersion.WithResource("vsconfigs")
+
+	// resources generated for a fork, which are labeled with the identifier
+	// sorted by kind for less flaky output
+	identifierLabeledResources = []labeledResource{
+		{"Deployment", appsv1.SchemeGroupVersion.WithResource("deployments")},
+		{"DeploymentCopy", schema.GroupVersionResource{Group: "duplication.k8s.wantedly.com", Version: "v1beta1", Resource: "deploymentcopies"}},
+		{"HTTPRoute", schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "httproutes"}},
+		{"Host", schema.GroupVersionResource{Group: "getambassador.io", Version: "v3alpha1", Resource: "hosts"}},
+		{"Ingress", schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}},
+		{"Mapping", schema.GroupVersionResource{Group: "getambassador.io", Version: "v2", Resource: "mappings"}},
+		{"Mapping", schema.GroupVersionResource{Group: "getambassador.io", Version: "v3alpha1", Resource: "mappings"}},
+		{"Service", v1.SchemeGroupVersion.WithResource("services")},
+		{"VSConfig", vsConfigResource},
+	}
+)
+
+type labeledResource struct {
+	kind     string
+	resource schema.GroupVersionResource
 }
 
 func NewClientSet(kubeConfigPath string, isConfigOptionChanged bool) (client.Client, error) {
@@ -40,7 +78,12 @@ func NewClientSet(kubeConfigPath string, isConfigOptionChanged bool) (client.Cli
 		return nil, errors.WithStack(err)
 	}
 
-	return k8sClientGo{clientSet}, nil
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return k8sClientGo{clientSet, dynamicClient}, nil
 }
 
 func (k k8sClientGo) GetAllServiceLabelsByServiceName(ctx context.Context, namespace, serviceName string) (map[string]string, error) {
@@ -105,3 +148,183 @@ func (k k8sClientGo) GetAllContainersByImageNameAndServiceAndDeploymentSelector(
 
 	return containerNames, nil
 }
+
+func (k k8sClientGo) ListForks(ctx context.Context, namespace string) ([]v1beta1.Fork, error) {
+	ul, err := k.dynamicClient.Resource(forkResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	forks := make([]v1beta1.Fork, len(ul.Items))
+	for i, u := range ul.Items {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &forks[i]); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return forks, nil
+}
+
+func (k k8sClientGo) ListForksByIdentifier(ctx context.Context, namespace, identifier string) ([]v1beta1.Fork, error) {
+	all, err := k.ListForks(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var forks []v1beta1.Fork
+	for _, f := range all {
+		// Forks written by hand may lack the identifier label, so compare the spec
+		if f.Spec.Identifier == identifier {
+			forks = append(forks, f)
+		}
+	}
+
+	return forks, nil
+}
+
+func (k k8sClientGo) GetForkManager(ctx context.Context, namespace, name string) (*v1beta1.ForkManager, error) {
+	u, err := k.dynamicClient.Resource(forkManagerResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fm := &v1beta1.ForkManager{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, fm); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return fm, nil
+}
+
+func (k k8sClientGo) UpdateForkDeadline(ctx context.Context, namespace, name string, deadline time.Time) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"deadline": metav1.NewTime(deadline),
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := k.dynamicClient.Resource(forkResource).Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (k k8sClientGo) GetFork(ctx context.Context, namespace, name string) (*v1beta1.Fork, error) {
+	u, err := k.dynamicClient.Resource(forkResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	f := &v1beta1.Fork{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, f); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return f, nil
+}
+
+func (k k8sClientGo) ApplyFork(ctx context.Context, fork *v1beta1.Fork) error {
+	// status is owned by the controller
+	f := fork.DeepCopy()
+	f.Status = v1beta1.ForkStatus{}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	force := true
+	if _, err := k.dynamicClient.Resource(forkResource).Namespace(f.Namespace).Patch(ctx, f.Name, types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (k k8sClientGo) GetVSConfig(ctx context.Context, namespace, name string) (*v1beta1.VSConfig, error) {
+	u, err := k.dynamicClient.Resource(vsConfigResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	vsc := &v1beta1.VSConfig{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, vsc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return vsc, nil
+}
+
+func (k k8sClientGo) GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	d, err := k.clientSet.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return d, nil
+}
+
+func (k k8sClientGo) ListPods(ctx context.Context, namespace string, selector *metav1.LabelSelector) ([]v1.Pod, error) {
+	ps, err := k.clientSet.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(selector),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ps.Items, nil
+}
+
+func (k k8sClientGo) DeleteFork(ctx context.Context, namespace, name string) error {
+	if err := k.dynamicClient.Resource(forkResource).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (k k8sClientGo) ListLabeledResources(ctx context.Context, namespace, identifier string) ([]v1beta1.ForkResource, error) {
+	var resources []v1beta1.ForkResource
+	for _, lr := range identifierLabeledResources {
+		ul, err := k.dynamicClient.Resource(lr.resource).Namespace(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: v1beta1.IdentifierLabelKey + "=" + identifier,
+		})
+		if err != nil {
+			// CRDs such as Mapping may not be installed
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, errors.WithStack(err)
+		}
+		for _, u := range ul.Items {
+			resources = append(resources, v1beta1.ForkResource{
+				APIVersion: lr.resource.GroupVersion().String(),
+				Kind:       lr.kind,
+				Namespace:  u.GetNamespace(),
+				Name:       u.GetName(),
+			})
+		}
+	}
+
+	return resources, nil
+}
+
+func (k k8sClientGo) DeleteResource(ctx context.Context, resource v1beta1.ForkResource) error {
+	for _, lr := range identifierLabeledResources {
+		if lr.kind != resource.Kind || lr.resource.GroupVersion().String() != resource.APIVersion {
+			continue
+		}
+		if err := k.dynamicClient.Resource(lr.resource).Namespace(resource.Namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{}); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+
+	return errors.Errorf("unsupported kind %s of %s", resource.Kind, resource.APIVersion)
+}
@@ -17,8 +17,10 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -32,10 +34,12 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	ddv1beta1 "github.com/wantedly/deployment-duplicator/api/v1beta1"
 	forkv1beta1 "github.com/wantedly/kubefork-controller/api/v1beta1"
 	"github.com/wantedly/kubefork-controller/controllers"
+	emissary "github.com/wantedly/kubefork-controller/pkg/api/getambassador.io/v3alpha1"
 )
 
 var (
@@ -48,9 +52,11 @@ func init() {
 	utilruntime.Must(forkv1beta1.AddToScheme(scheme))
 	utilruntime.Must(ddv1beta1.AddToScheme(scheme))
 	utilruntime.Must(istio.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1beta1.AddToScheme(scheme))
 
 	// TODO: make opt-in to the Ambassador API
 	utilruntime.Must(ambassador.AddToScheme(scheme))
+	utilruntime.Must(emissary.AddToScheme(scheme))
 
 	//+kubebuilder:scaffold:scheme
 }
@@ -59,11 +65,17 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var expiryWarning time.Duration
+	var routingBackend string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&expiryWarning, "expiry-warning", 30*time.Minute,
+		"How long before the deadline a Fork is warned of its expiry. Set 0 to disable.")
+	flag.StringVar(&routingBackend, "routing-backend", string(forkv1beta1.RoutingBackendIstio),
+		"The routing backend used for VSConfigs whose ForkManager doesn't specify one. Istio or GatewayAPI.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -72,6 +84,13 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	switch forkv1beta1.RoutingBackend(routingBackend) {
+	case forkv1beta1.RoutingBackendIstio, forkv1beta1.RoutingBackendGatewayAPI:
+	default:
+		setupLog.Error(nil, "unknown routing backend", "backend", routingBackend)
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -96,20 +115,57 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = controllers.IndexFields(context.Background(), mgr); err != nil {
+		setupLog.Error(err, "unable to index fields")
+		os.Exit(1)
+	}
 	if err = (&controllers.VSConfigReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		RoutingBackend: forkv1beta1.RoutingBackend(routingBackend),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VSConfig")
 		os.Exit(1)
 	}
+	if err = (&controllers.ServiceReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		RoutingBackend: forkv1beta1.RoutingBackend(routingBackend),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Service")
+		os.Exit(1)
+	}
 	if err = (&controllers.ForkReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      mgr.GetEventRecorderFor("fork-controller"),
+		ExpiryWarning: expiryWarning,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Fork")
 		os.Exit(1)
 	}
+	if err = (&controllers.ForkManagerReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("forkmanager-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ForkManager")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&forkv1beta1.Fork{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Fork")
+			os.Exit(1)
+		}
+		if err = (&forkv1beta1.ForkManager{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ForkManager")
+			os.Exit(1)
+		}
+		if err = (&forkv1beta1.VSConfig{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "VSConfig")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -0,0 +1,71 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ACMEProviderSpec configures certificates issued by ACME
+type ACMEProviderSpec struct {
+	// Authority is the URL of the ACME server, "none" disables ACME
+	Authority string `json:"authority,omitempty"`
+}
+
+// TLSSecretReference refers to a Secret of type kubernetes.io/tls
+type TLSSecretReference struct {
+	Name string `json:"name"`
+
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// HostSpec defines the desired state of Host
+type HostSpec struct {
+	AmbassadorID []string `json:"ambassador_id,omitempty"`
+
+	// Hostname is a glob pattern of the hosts served
+	Hostname string `json:"hostname,omitempty"`
+
+	// +optional
+	ACMEProvider *ACMEProviderSpec `json:"acmeProvider,omitempty"`
+	// +optional
+	TLSSecret *TLSSecretReference `json:"tlsSecret,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// Host is the Schema for the hosts API
+type Host struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HostSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// HostList contains a list of Host
+type HostList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Host `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Host{}, &HostList{})
+}
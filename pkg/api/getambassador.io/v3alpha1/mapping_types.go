@@ -0,0 +1,97 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v3alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AddedHeader is a header added to requests
+type AddedHeader struct {
+	Value string `json:"value"`
+
+	// +optional
+	Append *bool `json:"append,omitempty"`
+}
+
+// MappingSpec defines the desired state of Mapping
+type MappingSpec struct {
+	AmbassadorID []string `json:"ambassador_id,omitempty"`
+
+	// Hostname is a glob pattern of the Host header requests are matched with
+	Hostname string `json:"hostname,omitempty"`
+	Prefix   string `json:"prefix"`
+	Service  string `json:"service"`
+
+	// +optional
+	Rewrite     *string `json:"rewrite,omitempty"`
+	HostRewrite string  `json:"host_rewrite,omitempty"`
+
+	AddRequestHeaders     map[string]AddedHeader `json:"add_request_headers,omitempty"`
+	RemoveRequestHeaders  []string               `json:"remove_request_headers,omitempty"`
+	AddResponseHeaders    map[string]AddedHeader `json:"add_response_headers,omitempty"`
+	RemoveResponseHeaders []string               `json:"remove_response_headers,omitempty"`
+	AllowUpgrade          []string               `json:"allow_upgrade,omitempty"`
+	TimeoutMs             int                    `json:"timeout_ms,omitempty"`
+	IdleTimeoutMs         int                    `json:"idle_timeout_ms,omitempty"`
+	GRPC                  bool                   `json:"grpc,omitempty"`
+
+	// +optional
+	CORS *CORS `json:"cors,omitempty"`
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retry_policy,omitempty"`
+}
+
+// CORS is a CORS policy of a Mapping
+type CORS struct {
+	Origins        []string `json:"origins,omitempty"`
+	Methods        []string `json:"methods,omitempty"`
+	Headers        []string `json:"headers,omitempty"`
+	Credentials    bool     `json:"credentials,omitempty"`
+	ExposedHeaders []string `json:"exposed_headers,omitempty"`
+	MaxAge         string   `json:"max_age,omitempty"`
+}
+
+// RetryPolicy is a retry policy of a Mapping
+type RetryPolicy struct {
+	RetryOn       string `json:"retry_on,omitempty"`
+	NumRetries    int    `json:"num_retries,omitempty"`
+	PerTryTimeout string `json:"per_try_timeout,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// Mapping is the Schema for the mappings API
+type Mapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MappingSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MappingList contains a list of Mapping
+type MappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Mapping `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Mapping{}, &MappingList{})
+}
@@ -2,10 +2,15 @@ package refresh
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"reflect"
 
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -48,9 +53,18 @@ type Refresher interface {
 	Refresh(ctx context.Context, parent client.Object, list ObjectList) error
 }
 
+// Observer is notified of an object which Refresh created, or updated because it differed from the desired state
+// An update is notified only when the desired state is the same as the one last applied, i.e. the object was changed by others
+type Observer func(parent, obj client.Object, result util.OperationResult)
+
+// DesiredHashAnnotationKey is annotated with the hash of the desired state last applied
+// It tells changes of the desired state from changes made by others
+const DesiredHashAnnotationKey = "fork.k8s.wantedly.com/desired-hash"
+
 type refresher struct {
-	client client.Client
-	scheme *runtime.Scheme
+	client    client.Client
+	scheme    *runtime.Scheme
+	observers []Observer
 }
 
 type ObjectList struct {
@@ -59,8 +73,8 @@ type ObjectList struct {
 	Identity         func(client.Object) (string, error)
 }
 
-func New(client client.Client, scheme *runtime.Scheme) Refresher {
-	return &refresher{client, scheme}
+func New(client client.Client, scheme *runtime.Scheme, observers ...Observer) Refresher {
+	return &refresher{client, scheme, observers}
 }
 
 func (r refresher) Refresh(ctx context.Context, parent client.Object, list ObjectList) error {
@@ -89,36 +103,129 @@ func (r refresher) Refresh(ctx context.Context, parent client.Object, list Objec
 				emptyObj.SetName(name)
 			}
 		}
-		if _, err := util.CreateOrUpdate(ctx, r.client, emptyObj, func() error {
-			{
-				v := emptyObj.GetResourceVersion()
-				ns := emptyObj.GetNamespace()
-				n := emptyObj.GetName()
-
-				defer func() {
-					// to prevent resource version being nil
-					emptyObj.SetResourceVersion(v)
-					// because we cannot update namespace and name mutateFn
-					// we set those back
-					emptyObj.SetNamespace(ns)
-					emptyObj.SetName(n)
-				}()
-			}
+		if err := r.apply(ctx, parent, obj, emptyObj); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 
-			// TODO: if the resource already exists and not owned by this, it should return error
-			if err := r.scheme.Convert(obj, emptyObj, nil); err != nil {
-				return errors.WithStack(err)
-			}
+	return nil
+}
 
-			return errors.WithStack(util.SetControllerReference(parent, emptyObj, r.scheme))
-		}); err != nil {
+// Apply creates or updates an object named after obj in the namespace of obj so that it is in the state of obj and controlled by parent
+// observers are notified of the object in the same way as Refresh
+func Apply(ctx context.Context, c client.Client, scheme *runtime.Scheme, parent, obj client.Object, observers ...Observer) error {
+	emptyObj := reflect.New(reflect.ValueOf(obj).Elem().Type()).Interface().(client.Object)
+	emptyObj.SetNamespace(obj.GetNamespace())
+	emptyObj.SetName(obj.GetName())
+	return errors.WithStack(refresher{c, scheme, observers}.apply(ctx, parent, obj, emptyObj))
+}
+
+// apply makes emptyObj, whose namespace and name are set, into the state of obj
+func (r refresher) apply(ctx context.Context, parent, obj, emptyObj client.Object) error {
+	hash, err := desiredHash(obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var current client.Object
+	result, err := util.CreateOrUpdate(ctx, r.client, emptyObj, func() error {
+		// keep the existing state to tell whether it differed from the desired state
+		current = emptyObj.DeepCopyObject().(client.Object)
+		{
+			v := emptyObj.GetResourceVersion()
+			ns := emptyObj.GetNamespace()
+			n := emptyObj.GetName()
+
+			defer func() {
+				// to prevent resource version being nil
+				emptyObj.SetResourceVersion(v)
+				// because we cannot update namespace and name mutateFn
+				// we set those back
+				emptyObj.SetNamespace(ns)
+				emptyObj.SetName(n)
+			}()
+		}
+
+		// TODO: if the resource already exists and not owned by this, it should return error
+		if err := r.scheme.Convert(obj, emptyObj, nil); err != nil {
 			return errors.WithStack(err)
 		}
-	}
+		annotations := emptyObj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[DesiredHashAnnotationKey] = hash
+		emptyObj.SetAnnotations(annotations)
 
+		return errors.WithStack(util.SetControllerReference(parent, emptyObj, r.scheme))
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// server-side defaults make an update happen even when nothing was changed by others
+	if result == util.OperationResultUpdated && derivedFrom(obj, current) {
+		result = util.OperationResultNone
+	}
+	observed := result
+	// an update for a new desired state is not a change by others, nor is one of objects applied before hashes were annotated
+	if result == util.OperationResultUpdated && current.GetAnnotations()[DesiredHashAnnotationKey] != hash {
+		observed = util.OperationResultNone
+	}
+	for _, observe := range r.observers {
+		observe(parent, emptyObj, observed)
+	}
 	return nil
 }
 
+// desiredHash returns a hash of the fields of the object derivedFrom compares
+func desiredHash(obj client.Object) (string, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	metadata, _ := u["metadata"].(map[string]interface{})
+	u["metadata"] = map[string]interface{}{
+		"labels":      metadata["labels"],
+		"annotations": metadata["annotations"],
+	}
+	delete(u, "apiVersion")
+	delete(u, "kind")
+	delete(u, "status")
+
+	// maps are encoded in order of keys, so the same state has the same hash
+	b, err := json.Marshal(u)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// derivedFrom reports whether current has all fields set in desired, except for metadata other than labels and annotations and status
+func derivedFrom(desired, current client.Object) bool {
+	d, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return false
+	}
+	c, err := runtime.DefaultUnstructuredConverter.ToUnstructured(current)
+	if err != nil {
+		return false
+	}
+
+	for _, obj := range []map[string]interface{}{d, c} {
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		obj["metadata"] = map[string]interface{}{
+			"labels":      metadata["labels"],
+			"annotations": metadata["annotations"],
+		}
+		delete(obj, "apiVersion")
+		delete(obj, "kind")
+		delete(obj, "status")
+	}
+
+	return equality.Semantic.DeepDerivative(d, c)
+}
+
 // handleExisting is responsible of two things
 // - collect information about existing objects to be updated
 // - delete outdated objects
@@ -139,6 +246,10 @@ func (r refresher) handleExisting(ctx context.Context, parent client.Object, lis
 		currentObjs := &unstructured.UnstructuredList{}
 		currentObjs.SetGroupVersionKind(list.GroupVersionKind)
 		if err := r.client.List(ctx, currentObjs, &client.ListOptions{Namespace: parent.GetNamespace()}); err != nil {
+			// there is nothing to delete when the kind is not installed, e.g. an unused routing backend
+			if len(list.Items) == 0 && (meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err)) {
+				return existingMap, nil
+			}
 			return nil, errors.WithStack(err)
 		}
 		for _, obj := range currentObjs.Items {
@@ -67,6 +67,52 @@ func SetForkName(name string) forkConfigOption {
 	}
 }
 
+func SetForkManager(manager string) forkConfigOption {
+	return func(fork *forkv1beta1.Fork) {
+		fork.Spec.Manager = manager
+	}
+}
+
+func AddForkSelector(labels map[string]string) forkConfigOption {
+	return func(fork *forkv1beta1.Fork) {
+		fork.Spec.Services = &forkv1beta1.ForkService{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		}
+		fork.Spec.Deployments = &forkv1beta1.ForkDeployment{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		}
+	}
+}
+
+func SetForkMirror(percentage int32) forkConfigOption {
+	return func(fork *forkv1beta1.Fork) {
+		fork.Spec.Mirror = &forkv1beta1.MirrorPolicy{Percentage: percentage}
+	}
+}
+
+func SetForkCanary(creation metav1.Time, weight int32, steps ...forkv1beta1.CanaryStep) forkConfigOption {
+	return func(fork *forkv1beta1.Fork) {
+		fork.CreationTimestamp = creation
+		fork.Spec.Canary = &forkv1beta1.CanaryPolicy{Weight: weight, Steps: steps}
+	}
+}
+
+func AddForkDeploymentAnnotation(key, value string) forkConfigOption {
+	return func(fork *forkv1beta1.Fork) {
+		if fork.Spec.Deployments == nil {
+			fork.Spec.Deployments = &forkv1beta1.ForkDeployment{}
+		}
+		if fork.Spec.Deployments.Template == nil {
+			fork.Spec.Deployments.Template = &forkv1beta1.PodTemplateSpec{ObjectMeta: &metav1.ObjectMeta{}}
+		}
+		if fork.Spec.Deployments.Template.Annotations == nil {
+			fork.Spec.Deployments.Template.Annotations = map[string]string{}
+		}
+
+		fork.Spec.Deployments.Template.Annotations[key] = value
+	}
+}
+
 func SetForUpgrades(protocol string) forkConfigOption {
 	return func(fork *forkv1beta1.Fork) {
 		if fork.Spec.GatewayOptions == nil {
@@ -129,6 +175,55 @@ func GenVSConfig(targetServiceName, identifier string) *forkv1beta1.VSConfig {
 	return vsc
 }
 
+func SetVSConfigName(vsc *forkv1beta1.VSConfig, name string) *forkv1beta1.VSConfig {
+	vsc.Name = name
+	return vsc
+}
+
+func SetVSConfigBackend(vsc *forkv1beta1.VSConfig, backend forkv1beta1.RoutingBackend) *forkv1beta1.VSConfig {
+	vsc.Spec.Backend = backend
+	return vsc
+}
+
+func SetVSConfigMatch(vsc *forkv1beta1.VSConfig, matchType forkv1beta1.MatchType, pattern string) *forkv1beta1.VSConfig {
+	vsc.Spec.MatchType = matchType
+	vsc.Spec.Pattern = pattern
+	return vsc
+}
+
+func SetVSConfigMatchName(vsc *forkv1beta1.VSConfig, name string) *forkv1beta1.VSConfig {
+	vsc.Spec.MatchName = name
+	return vsc
+}
+
+func SetVSConfigScope(vsc *forkv1beta1.VSConfig, scope forkv1beta1.RouteScope) *forkv1beta1.VSConfig {
+	vsc.Spec.Scope = &scope
+	return vsc
+}
+
+func SetVSConfigMirror(vsc *forkv1beta1.VSConfig, percentage int32) *forkv1beta1.VSConfig {
+	vsc.Spec.Mirror = &forkv1beta1.MirrorPolicy{Percentage: percentage}
+	return vsc
+}
+
+func SetVSConfigWeight(vsc *forkv1beta1.VSConfig, weight int32) *forkv1beta1.VSConfig {
+	vsc.Spec.Weight = weight
+	return vsc
+}
+
+func SetVSHTTPRoutes(vs *istio.VirtualService, routes ...*networkingv1beta1.HTTPRoute) *istio.VirtualService {
+	vs.Spec.Http = routes
+	return vs
+}
+
+func AddVSLabel(vs *istio.VirtualService, key, value string) *istio.VirtualService {
+	if vs.Labels == nil {
+		vs.Labels = map[string]string{}
+	}
+	vs.Labels[key] = value
+	return vs
+}
+
 func GenVS(name string, host string) *istio.VirtualService {
 	vs := &istio.VirtualService{
 		TypeMeta: metav1.TypeMeta{
@@ -189,6 +284,11 @@ func GenForkManager() *forkv1beta1.ForkManager {
 	}
 }
 
+func SetForkManagerAllowedNamespaces(fm *forkv1beta1.ForkManager, namespaces ...string) *forkv1beta1.ForkManager {
+	fm.Spec.AllowedNamespaces = namespaces
+	return fm
+}
+
 func GenForkManagerWithHostRewrite() *forkv1beta1.ForkManager {
 	return &forkv1beta1.ForkManager{
 		ObjectMeta: metav1.ObjectMeta{